@@ -2,10 +2,17 @@ package client
 
 import (
 	"context"
+	"encoding/hex"
+	"strings"
+	"time"
 
 	"github.com/CosmWasm/wasmd/x/wasm/types"
+	"github.com/cosmos/cosmos-sdk/client/grpc/tmservice"
+	txtypes "github.com/cosmos/cosmos-sdk/types/tx"
 	"github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
+
+	"juno-contracts-worker/db/model"
 )
 
 type Client struct {
@@ -55,3 +62,96 @@ func (c *Client) GetContractInfo(contractAddress string) (uint64, error) {
 
 	return res.CodeID, nil
 }
+
+func (c *Client) GetCodeChecksum(codeID uint64) (string, error) {
+	c.log.Debugf("Get code checksum for code id: %d", codeID)
+
+	queryClient := types.NewQueryClient(c.client)
+	res, err := queryClient.Code(
+		context.Background(),
+		&types.QueryCodeRequest{
+			CodeId: codeID,
+		},
+	)
+
+	if err != nil {
+		c.log.Errorf("can't get code info, code id: %d err: %s", codeID, err)
+		return "", err
+	}
+
+	return strings.ToLower(hex.EncodeToString(res.DataHash)), nil
+}
+
+func (c *Client) GetTx(txHash string) (*model.TxResult, error) {
+	c.log.Debugf("Get tx: %s", txHash)
+
+	serviceClient := txtypes.NewServiceClient(c.client)
+	res, err := serviceClient.GetTx(
+		context.Background(),
+		&txtypes.GetTxRequest{
+			Hash: txHash,
+		},
+	)
+
+	if err != nil {
+		c.log.Errorf("can't get tx, hash: %s err: %s", txHash, err)
+		return nil, err
+	}
+
+	txResponse := res.TxResponse
+	result := &model.TxResult{
+		Hash:      txResponse.TxHash,
+		Height:    txResponse.Height,
+		Code:      txResponse.Code,
+		Timestamp: txResponse.Timestamp,
+	}
+
+	if tx := res.Tx; tx != nil {
+		if tx.Body != nil {
+			result.Memo = tx.Body.Memo
+		}
+		if tx.AuthInfo != nil && tx.AuthInfo.Fee != nil {
+			result.Fee = tx.AuthInfo.Fee.Amount.String()
+		}
+	}
+
+	for _, l := range txResponse.Logs {
+		for _, e := range l.Events {
+			event := model.Event{
+				MsgIndex: int32(l.MsgIndex),
+				Type:     e.Type,
+			}
+			for _, a := range e.Attributes {
+				event.Attributes = append(event.Attributes, model.Attribute{Key: a.Key, Value: a.Value})
+			}
+			result.Events = append(result.Events, event)
+		}
+	}
+
+	return result, nil
+}
+
+func (c *Client) GetBlockByHeight(height int64) (*model.Block, error) {
+	c.log.Debugf("Get block by height: %d", height)
+
+	serviceClient := tmservice.NewServiceClient(c.client)
+	res, err := serviceClient.GetBlockByHeight(
+		context.Background(),
+		&tmservice.GetBlockByHeightRequest{
+			Height: height,
+		},
+	)
+
+	if err != nil {
+		c.log.Errorf("can't get block, height: %d err: %s", height, err)
+		return nil, err
+	}
+
+	header := res.Block.Header
+	return &model.Block{
+		Height:   header.Height,
+		Time:     header.Time.UTC().Format(time.RFC3339Nano),
+		Hash:     strings.ToUpper(hex.EncodeToString(res.BlockId.Hash)),
+		Proposer: strings.ToUpper(hex.EncodeToString(header.ProposerAddress)),
+	}, nil
+}
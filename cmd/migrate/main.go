@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+
+	"juno-contracts-worker/config"
+	"juno-contracts-worker/db"
+	"juno-contracts-worker/utils"
+)
+
+// migrate applies pending migration files or reverts the last ones,
+// usage: migrate --config config.json [--dir migrations] [--down 1]
+func main() {
+	configPath, dir, down := "", "", ""
+	args := os.Args[1:]
+
+	for i, a := range args {
+		if i == len(args)-1 {
+			break
+		}
+		switch a {
+		case "--config":
+			configPath = args[i+1]
+		case "--dir":
+			dir = args[i+1]
+		case "--down":
+			down = args[i+1]
+		}
+	}
+
+	config, err := config.ReadConfig(configPath)
+	if err != nil {
+		fmt.Println("Could not read config: ", err)
+		return
+	}
+	if dir == "" {
+		dir = config.MigrationsPath()
+	}
+
+	log := &logrus.Logger{
+		Out:       os.Stderr,
+		Formatter: new(logrus.TextFormatter),
+		Hooks:     make(logrus.LevelHooks),
+		Level:     utils.LogLevel(config.LogLevel),
+	}
+
+	migrator, err := db.NewMigrator(log, config.DbUser, config.DbPassword, config.DbName, dir)
+	if err != nil {
+		fmt.Println("Could not connect with database: ", err)
+		return
+	}
+	defer migrator.Close()
+
+	if down != "" {
+		steps, err := strconv.Atoi(down)
+		if err != nil || steps < 1 {
+			fmt.Println("Usage: migrate --config <path> [--dir <path>] [--down <steps>]")
+			os.Exit(1)
+		}
+
+		count, err := migrator.Down(steps)
+		fmt.Printf("Reverted %d migrations\n", count)
+		if err != nil {
+			fmt.Println("Could not revert migrations: ", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	count, err := migrator.Up()
+	fmt.Printf("Applied %d migrations\n", count)
+	if err != nil {
+		fmt.Println("Could not apply migrations: ", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sirupsen/logrus"
+
+	"juno-contracts-worker/config"
+	"juno-contracts-worker/db"
+	"juno-contracts-worker/indexer"
+	"juno-contracts-worker/utils"
+)
+
+// schema prints every version of an entity schema,
+// usage: schema --config config.json --entity msg_execute_contract_42 [--code-id 42]
+func main() {
+	configPath, entity, codeID := "", "", ""
+	args := os.Args[1:]
+
+	for i, a := range args {
+		if i == len(args)-1 {
+			break
+		}
+		switch a {
+		case "--config":
+			configPath = args[i+1]
+		case "--entity":
+			entity = args[i+1]
+		case "--code-id":
+			codeID = args[i+1]
+		}
+	}
+
+	if entity == "" {
+		fmt.Println("Usage: schema --config <path> --entity <name> [--code-id <id>]")
+		os.Exit(1)
+	}
+
+	config, err := config.ReadConfig(configPath)
+	if err != nil {
+		fmt.Println("Could not read config: ", err)
+		return
+	}
+
+	log := &logrus.Logger{
+		Out:       os.Stderr,
+		Formatter: new(logrus.TextFormatter),
+		Hooks:     make(logrus.LevelHooks),
+		Level:     utils.LogLevel(config.LogLevel),
+	}
+
+	dbService, err := db.New(log, config.DbUser, config.DbPassword, config.DbName)
+	if err != nil {
+		fmt.Println("Could not connect with database: ", err)
+		return
+	}
+	defer dbService.Close()
+
+	versions, err := indexer.New(nil, dbService, log, config).SchemaHistory(codeID, entity)
+	if err != nil {
+		fmt.Println("Could not read schema history: ", err)
+		os.Exit(1)
+	}
+
+	if len(versions) == 0 {
+		fmt.Printf("No schema versions of %s\n", entity)
+		return
+	}
+
+	for _, v := range versions {
+		fmt.Printf("code %s version %d first seen at height %d tx %s\n", v.CodeID, v.Version, v.Height, v.TxHash)
+		for _, c := range v.Diff {
+			if c.From == "" {
+				fmt.Printf("  + %s.%s %s\n", c.Table, c.Column, c.To)
+			} else {
+				fmt.Printf("  ~ %s.%s %s -> %s\n", c.Table, c.Column, c.From, c.To)
+			}
+		}
+	}
+}
@@ -8,9 +8,10 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"juno-contracts-worker/client"
-	"juno-contracts-worker/config"
+	conf "juno-contracts-worker/config"
 	"juno-contracts-worker/db"
 	"juno-contracts-worker/indexer"
+	"juno-contracts-worker/projector"
 	"juno-contracts-worker/utils"
 	"juno-contracts-worker/worker"
 )
@@ -26,7 +27,7 @@ func main() {
 		}
 	}
 
-	config, err := config.ReadConfig(configPath)
+	config, err := conf.ReadConfig(configPath)
 	if err != nil {
 		fmt.Println("Could not read config: ", err)
 		return
@@ -47,6 +48,31 @@ func main() {
 	dbWithLimiter := db.NewServiceWithConnectionLimiter(dbService)
 	defer dbWithLimiter.Close()
 
+	switch config.Migrations {
+	case "":
+	case conf.MigrationsApply:
+		migrator, err := db.NewMigrator(log, config.DbUser, config.DbPassword, config.DbName, config.MigrationsPath())
+		if err != nil {
+			fmt.Println("Could not connect with database: ", err)
+			return
+		}
+		_, err = migrator.Up()
+		migrator.Close()
+		if err != nil {
+			fmt.Println("Could not apply migrations: ", err)
+			return
+		}
+	case conf.MigrationsExport:
+		dbWithLimiter, err = db.NewMigrationWriter(dbWithLimiter, log, config.MigrationsPath())
+		if err != nil {
+			fmt.Println("Could not export migrations: ", err)
+			return
+		}
+	default:
+		fmt.Println("Unknown migrations mode: ", config.Migrations)
+		return
+	}
+
 	grpcClient, err := client.New(config.GrpcUrl, log)
 	if err != nil {
 		fmt.Println(err)
@@ -55,9 +81,11 @@ func main() {
 
 	defer grpcClient.Close()
 
-	indexer := indexer.New(grpcClient, dbWithLimiter, log)
+	indexer := indexer.New(grpcClient, dbWithLimiter, log, config)
+
+	projector := projector.New(dbWithLimiter, log, config)
 
-	worker, err := worker.New(dbWithLimiter, log, indexer)
+	worker, err := worker.New(dbWithLimiter, log, indexer, projector, config)
 	if err != nil {
 		fmt.Println("Error while creating sync: ", err)
 		return
@@ -2,7 +2,9 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
+	"strings"
 )
 
 type Config struct {
@@ -14,6 +16,103 @@ type Config struct {
 	ResolversPath string   `json:"resolvers_path"`
 	SchemaPath    string   `json:"schema_path"`
 	Messages      []string `json:"messages"`
+
+	// EventsTable is read instead of querying the node for tx events when set
+	EventsTable string `json:"events_table"`
+	// EventProjections lists wasm attributes stored as columns per code ID
+	EventProjections map[string][]EventAttribute `json:"event_projections"`
+	// Cw20CodeIDs are treated as cw20 tokens even when their instantiation was not indexed
+	Cw20CodeIDs []string `json:"cw20_code_ids"`
+	// Cw721CodeIDs are treated as cw721 collections even when their instantiation was not indexed
+	Cw721CodeIDs []string `json:"cw721_code_ids"`
+	// DaoProposalCodeIDs and Cw4GroupCodeIDs are dao dao modules indexed without their dao instantiation
+	DaoProposalCodeIDs []string `json:"dao_proposal_code_ids"`
+	Cw4GroupCodeIDs    []string `json:"cw4_group_code_ids"`
+	// NumericStringCodeIDs map numeric-looking string fields, like Uint128 and Decimal, to NUMERIC columns
+	NumericStringCodeIDs []string `json:"numeric_string_code_ids"`
+	// RawCodeIDs are saved as JSON in raw_messages instead of normalized tables
+	RawCodeIDs []string `json:"raw_code_ids"`
+	// ContractSchemas map code IDs to cosmwasm-schema directories, their tables are created from the schema
+	ContractSchemas map[string]string `json:"contract_schemas"`
+	// BinaryFields are keys of base64 Binary fields decoded into child entities, "msg" when empty
+	BinaryFields []string `json:"binary_fields"`
+	// DetectBinary tries to decode every string field as base64 JSON
+	DetectBinary bool `json:"detect_binary"`
+	// Indexes are extra indexes of entity tables keyed by code ID, they are created concurrently
+	Indexes map[string][]IndexOptions `json:"indexes"`
+	// TypeConflicts is the policy for values that do not fit the live column type:
+	// TypeConflictWiden (default), TypeConflictSibling or TypeConflictQuarantine
+	TypeConflicts string `json:"type_conflicts"`
+	// Migrations is MigrationsExport to write schema changes as migration files
+	// or MigrationsApply to apply pending migration files at start
+	Migrations string `json:"migrations"`
+	// MigrationsDir holds the numbered up and down migration files, "migrations" when empty
+	MigrationsDir string `json:"migrations_dir"`
+	// MessageOptions are keyed by message table name
+	MessageOptions map[string]MessageOptions `json:"message_options"`
+}
+
+const (
+	FailedTxSkip = "skip"
+	FailedTxFlag = "flag"
+)
+
+const (
+	TypeConflictWiden      = "widen"
+	TypeConflictSibling    = "sibling"
+	TypeConflictQuarantine = "quarantine"
+)
+
+const (
+	MigrationsExport = "export"
+	MigrationsApply  = "apply"
+)
+
+// IndexOptions name the table by its message table and the keys leading from the message root to it
+type IndexOptions struct {
+	Message string   `json:"message"`
+	Path    []string `json:"path"`
+	Columns []string `json:"columns"`
+}
+
+// EventAttribute is a projected wasm attribute, written as "key" for a TEXT column
+// or as {"key": "amount", "type": "NUMERIC"}
+type EventAttribute struct {
+	Key  string `json:"key"`
+	Type string `json:"type"`
+}
+
+// eventAttributeTypes are the column types of projected attributes
+var eventAttributeTypes = map[string]bool{
+	"TEXT":    true,
+	"BIGINT":  true,
+	"NUMERIC": true,
+	"BOOLEAN": true,
+}
+
+func (a *EventAttribute) UnmarshalJSON(data []byte) error {
+	var key string
+	if err := json.Unmarshal(data, &key); err == nil {
+		a.Key = key
+		return nil
+	}
+
+	type attribute EventAttribute
+	return json.Unmarshal(data, (*attribute)(a))
+}
+
+func (a EventAttribute) ColumnType() string {
+	if a.Type == "" {
+		return "TEXT"
+	}
+	return strings.ToUpper(a.Type)
+}
+
+type MessageOptions struct {
+	// FailedTx is FailedTxSkip (default) or FailedTxFlag
+	FailedTx string `json:"failed_tx"`
+	// CodeColumn is the message table column with the tx result code, the code is queried over grpc when empty
+	CodeColumn string `json:"code_column"`
 }
 
 func ReadConfig(path string) (*Config, error) {
@@ -27,5 +126,60 @@ func ReadConfig(path string) (*Config, error) {
 		return nil, err
 	}
 
+	if err = cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+
 	return &cfg, nil
 }
+
+func (c *Config) validate() error {
+	switch c.TypeConflicts {
+	case "", TypeConflictWiden, TypeConflictSibling, TypeConflictQuarantine:
+	default:
+		return fmt.Errorf("unknown type_conflicts policy %q, use %s, %s or %s",
+			c.TypeConflicts, TypeConflictWiden, TypeConflictSibling, TypeConflictQuarantine)
+	}
+
+	for codeID, attributes := range c.EventProjections {
+		for _, a := range attributes {
+			if a.Key == "" {
+				return fmt.Errorf("event projection of code id %s has an attribute without key", codeID)
+			}
+			if !eventAttributeTypes[a.ColumnType()] {
+				return fmt.Errorf("event projection %s of code id %s has unsupported type %s", a.Key, codeID, a.Type)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *Config) Message(tableName string) MessageOptions {
+	opts := c.MessageOptions[tableName]
+	if opts.FailedTx == "" {
+		opts.FailedTx = FailedTxSkip
+	}
+	return opts
+}
+
+func (c *Config) TypeConflictPolicy() string {
+	if c.TypeConflicts == "" {
+		return TypeConflictWiden
+	}
+	return c.TypeConflicts
+}
+
+func (c *Config) BinaryFieldNames() []string {
+	if len(c.BinaryFields) == 0 {
+		return []string{"msg"}
+	}
+	return c.BinaryFields
+}
+
+func (c *Config) MigrationsPath() string {
+	if c.MigrationsDir == "" {
+		return "migrations"
+	}
+	return c.MigrationsDir
+}
@@ -3,6 +3,7 @@ package db
 import (
 	"database/sql"
 	"fmt"
+	"sort"
 	"strings"
 
 	_ "github.com/lib/pq"
@@ -17,20 +18,62 @@ type ServiceInterface interface {
 	CreateTable(tableName string, fields model.Fields) error
 	CreateColumn(tableName, columnName, columnType string) error
 	Select(tableName string, fields []string, qParams *model.QParameters) (*sql.Rows, error)
-	Update(tableName string, qParams model.QParameters, fields map[string]string) error
+	Update(tableName string, qParams model.QParameters, fields map[string]any) error
 	TableExists(tableName string) (bool, error)
 	CreateUniqueIndex(columns []string, indexName, tableName string) error
 	AddColumn(idxName, parentTableName, tableName string) error
 	Insert(tableName string, fieldNames []string, values []any) error
 	LinkTable(id, linkID, idxName, tableName string) error
+	ColumnTypes(tableName string) (map[string]string, error)
+	AlterColumnType(tableName, columnName, columnType string) error
+	CreateIndex(columns []string, indexName, tableName string) error
+	// IndexValid reports whether the index exists and its build finished
+	IndexValid(indexName string) (bool, error)
+	// RenameTable and RenameColumn take the names as they are, they upgrade names of older versions
+	RenameTable(oldName, newName string) error
+	RenameColumn(tableName, oldName, newName string) error
+	// Begin starts a transaction, every statement of the returned service runs in it
+	Begin() (TxInterface, error)
+}
+
+// TxInterface is a service bound to a transaction, it is used by a single goroutine
+type TxInterface interface {
+	ServiceInterface
+	Commit() error
+	Rollback() error
+}
+
+// querier runs statements on the connection pool or in a transaction
+type querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
 }
 
 type Service struct {
 	conn *sql.DB
+	q    querier
 	log  *logrus.Logger
 }
 
 func New(log *logrus.Logger, user, password, dbName string) (ServiceInterface, error) {
+	conn, err := open(user, password, dbName)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewWithConn(log, conn), nil
+}
+
+// NewWithConn returns a service running its statements on an open connection pool
+func NewWithConn(log *logrus.Logger, conn *sql.DB) ServiceInterface {
+	return &Service{
+		conn: conn,
+		q:    conn,
+		log:  log,
+	}
+}
+
+func open(user, password, dbName string) (*sql.DB, error) {
 	dbinfo := fmt.Sprintf("user=%s password=%s dbname=%s sslmode=disable",
 		user, password, dbName)
 
@@ -38,11 +81,7 @@ func New(log *logrus.Logger, user, password, dbName string) (ServiceInterface, e
 	if err != nil {
 		return nil, fmt.Errorf("could not connect with database: %w", err)
 	}
-
-	return &Service{
-		conn: conn,
-		log:  log,
-	}, nil
+	return conn, nil
 }
 
 func (s *Service) Close() {
@@ -52,14 +91,11 @@ func (s *Service) Close() {
 
 func (s *Service) CreateTable(tableName string, fields model.Fields) error {
 	tableName = utils.UniqueShortName(tableName)
-	q := fmt.Sprintf(`
-	CREATE TABLE IF NOT EXISTS app.%s (
-		id UUID PRIMARY KEY%s
-	);`, tableName, fields.CreateTableString())
+	q := createTableQuery(tableName, fields)
 
 	s.log.Debugf("Create table %s query: %s", tableName, q)
 
-	if _, err := s.conn.Exec(q); err != nil {
+	if _, err := s.q.Exec(q); err != nil {
 		return err
 	}
 
@@ -68,12 +104,11 @@ func (s *Service) CreateTable(tableName string, fields model.Fields) error {
 
 func (s *Service) CreateColumn(tableName, columnName, columnType string) error {
 	tableName = utils.UniqueShortName(tableName)
-	q := fmt.Sprintf(`ALTER TABLE app.%s ADD COLUMN IF NOT EXISTS %s %s;`,
-		tableName, columnName, columnType)
+	q := createColumnQuery(tableName, columnName, columnType)
 
 	s.log.Debugf("Add column to table %s query: %s", tableName, q)
 
-	if _, err := s.conn.Exec(q); err != nil {
+	if _, err := s.q.Exec(q); err != nil {
 		fmt.Println("could not add column: ", err)
 		return err
 	}
@@ -82,37 +117,61 @@ func (s *Service) CreateColumn(tableName, columnName, columnType string) error {
 }
 
 func (s *Service) Select(tableName string, fields []string, qParams *model.QParameters) (*sql.Rows, error) {
-	q := fmt.Sprintf("SELECT %s FROM app.%s %s;",
-		strings.Join(fields, ", "), tableName, qParams.Print())
+	if err := validIdentifiers(fields); err != nil {
+		return nil, err
+	}
+
+	clauses, values, err := qParams.Build(0)
+	if err != nil {
+		return nil, err
+	}
+
+	q := fmt.Sprintf("SELECT %s FROM %s %s;",
+		strings.Join(utils.QuoteIdentifiers(fields), ", "), table(tableName), clauses)
 
 	s.log.Debugf("Select query: %s", q)
-	return s.conn.Query(q)
+	return s.q.Query(q, values...)
 }
 
-func (s *Service) Update(tableName string, qParams model.QParameters, fields map[string]string) error {
+func (s *Service) Update(tableName string, qParams model.QParameters, fields map[string]any) error {
+	columns := make([]string, 0, len(fields))
+	for k := range fields {
+		columns = append(columns, k)
+	}
+	sort.Strings(columns)
+	if err := validIdentifiers(columns); err != nil {
+		return err
+	}
+
 	updateFields := []string{}
-	for k, v := range fields {
-		updateFields = append(updateFields, fmt.Sprintf(`%s=%s`, k, v))
+	values := []any{}
+	for _, k := range columns {
+		values = append(values, fields[k])
+		updateFields = append(updateFields, fmt.Sprintf(`%s=$%d`, utils.QuoteIdentifier(k), len(values)))
 	}
-	q := fmt.Sprintf("UPDATE app.%s SET %s %s;",
-		tableName, strings.Join(updateFields, ", "), qParams.Print())
+
+	clauses, whereValues, err := qParams.Build(len(values))
+	if err != nil {
+		return err
+	}
+
+	q := fmt.Sprintf("UPDATE %s SET %s %s;",
+		table(tableName), strings.Join(updateFields, ", "), clauses)
 
 	s.log.Debugf("Update query: %s", q)
 
-	_, err := s.conn.Exec(q)
+	_, err = s.q.Exec(q, append(values, whereValues...)...)
 	return err
 }
 
 func (s *Service) TableExists(tableName string) (bool, error) {
 	var str string
 	tableName = utils.UniqueShortName(tableName)
-	q := fmt.Sprintf("SELECT to_regclass('app.%s');",
-		tableName)
-
-	rows, err := s.conn.Query(q)
+	rows, err := s.q.Query("SELECT to_regclass($1);", table(tableName))
 	if err != nil {
 		return false, err
 	}
+	defer rows.Close()
 
 	for rows.Next() {
 		if err = rows.Scan(&str); err != nil {
@@ -127,33 +186,75 @@ func (s *Service) TableExists(tableName string) (bool, error) {
 func (s *Service) CreateUniqueIndex(columns []string, indexName, tableName string) error {
 	indexName = utils.UniqueShortName(indexName)
 	tableName = utils.UniqueShortName(tableName)
-	q := fmt.Sprintf(`CREATE UNIQUE INDEX IF NOT EXISTS %s ON app.%s(%s);`,
-		indexName, tableName, strings.Join(columns, ", "))
+	q := createUniqueIndexQuery(columns, indexName, tableName)
 
 	s.log.Debugf("Create unique index query: %s", q)
-	_, err := s.conn.Exec(q)
+	_, err := s.q.Exec(q)
+	return err
+}
+
+func (s *Service) CreateIndex(columns []string, indexName, tableName string) error {
+	indexName = utils.UniqueShortName(indexName)
+	tableName = utils.UniqueShortName(tableName)
+	return s.buildIndex(s.q, indexName, createIndexQuery(columns, indexName, tableName))
+}
+
+// buildIndex drops the INVALID index a failed build left behind, IF NOT EXISTS would skip it, and builds it again
+func (s *Service) buildIndex(q querier, indexName, query string) error {
+	exists, valid, err := indexState(q, indexName)
+	if err != nil {
+		return fmt.Errorf("could not read state of index %s: %w", indexName, err)
+	}
+	if exists && !valid {
+		s.log.Warnf("Index %s is invalid, it is dropped and built again", indexName)
+		if _, err = q.Exec(dropInvalidIndexQuery(indexName)); err != nil {
+			return fmt.Errorf("could not drop invalid index %s: %w", indexName, err)
+		}
+	}
+
+	s.log.Debugf("Create index query: %s", query)
+	_, err = q.Exec(query)
 	return err
 }
 
+func (s *Service) IndexValid(indexName string) (bool, error) {
+	exists, valid, err := indexState(s.q, utils.UniqueShortName(indexName))
+	return exists && valid, err
+}
+
+func indexState(q querier, indexName string) (exists, valid bool, err error) {
+	rows, err := q.Query("SELECT indisvalid FROM pg_index WHERE indexrelid = to_regclass($1);", table(indexName))
+	if err != nil {
+		return false, false, err
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		if err = rows.Scan(&valid); err != nil {
+			return false, false, err
+		}
+		exists = true
+	}
+	return exists, valid, rows.Err()
+}
+
 func (s *Service) AddColumn(idxName, parentTableName, tableName string) error {
 	idxName = utils.UniqueShortName(idxName)
 	tableName = utils.UniqueShortName(tableName)
-	q := fmt.Sprintf(`ALTER TABLE app.%s ADD COLUMN IF NOT EXISTS %s UUID REFERENCES app.%s;`,
-		parentTableName, idxName, tableName)
+	q := addColumnQuery(idxName, parentTableName, tableName)
 
 	s.log.Debugf("Create index query: %s", q)
-	_, err := s.conn.Exec(q)
+	_, err := s.q.Exec(q)
 	return err
 }
 
 func (s *Service) Insert(tableName string, fieldNames []string, values []any) error {
 	tableName = utils.UniqueShortName(tableName)
-	fieldNames = utils.AddUnderscoresIfMissing(fieldNames)
 
-	q := fmt.Sprintf(`INSERT INTO app.%s (%s) VALUES (%s) ON CONFLICT DO NOTHING;`,
-		tableName, strings.Join(fieldNames, ", "), printValueNames(len(fieldNames)))
+	q := fmt.Sprintf(`INSERT INTO %s (%s) VALUES (%s) ON CONFLICT DO NOTHING;`,
+		table(tableName), strings.Join(utils.QuoteIdentifiers(fieldNames), ", "), printValueNames(len(fieldNames)))
 
-	if _, err := s.conn.Exec(q, values...); err != nil {
+	if _, err := s.q.Exec(q, values...); err != nil {
 		err = fmt.Errorf("could not insert into database, err: %w", err)
 		s.log.Error(err)
 		return err
@@ -172,13 +273,96 @@ func printValueNames(len int) string {
 
 func (s *Service) LinkTable(id, linkID, idxName, tableName string) error {
 	idxName = utils.UniqueShortName(idxName)
-	q := fmt.Sprintf(`UPDATE app.%s SET %s='%s' WHERE id='%s';`,
-		tableName, idxName, linkID, id)
+	q := fmt.Sprintf(`UPDATE %s SET %s=$1 WHERE id=$2;`,
+		table(tableName), utils.QuoteIdentifier(idxName))
 
-	s.log.Debugf("Link query: ", q)
-	if _, err := s.conn.Exec(q); err != nil {
+	s.log.Debugf("Link query: %s", q)
+	if _, err := s.q.Exec(q, linkID, id); err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// validIdentifiers rejects column names that would be changed by quoting
+func validIdentifiers(names []string) error {
+	for _, name := range names {
+		if !utils.IsIdentifier(name) {
+			return fmt.Errorf("invalid column name %q", name)
+		}
+	}
+	return nil
+}
+
+// table is the quoted name of a table in the app schema
+func table(name string) string {
+	return "app." + utils.QuoteIdentifier(name)
+}
+
+// udtTypes maps postgres type names to the names used in table definitions
+var udtTypes = map[string]string{
+	"int8":        "BIGINT",
+	"int4":        "INT",
+	"numeric":     "NUMERIC",
+	"text":        "TEXT",
+	"bool":        "BOOLEAN",
+	"uuid":        "UUID",
+	"jsonb":       "JSONB",
+	"timestamptz": "TIMESTAMPTZ",
+	"_text":       "TEXT[]",
+	"_numeric":    "NUMERIC[]",
+	"_bool":       "BOOLEAN[]",
+}
+
+func (s *Service) ColumnTypes(tableName string) (map[string]string, error) {
+	var column, udtName string
+	tableName = utils.UniqueShortName(tableName)
+	q := `SELECT column_name, udt_name FROM information_schema.columns
+	WHERE table_schema = 'app' AND table_name = $1;`
+
+	rows, err := s.q.Query(q, tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make(map[string]string)
+	for rows.Next() {
+		if err = rows.Scan(&column, &udtName); err != nil {
+			return nil, err
+		}
+
+		columnType, ok := udtTypes[udtName]
+		if !ok {
+			columnType = strings.ToUpper(udtName)
+		}
+		columns[column] = columnType
+	}
+
+	return columns, nil
+}
+
+func (s *Service) AlterColumnType(tableName, columnName, columnType string) error {
+	tableName = utils.UniqueShortName(tableName)
+	q := alterColumnTypeQuery(tableName, columnName, columnType)
+
+	s.log.Debugf("Alter column type query: %s", q)
+	_, err := s.q.Exec(q)
+	return err
+}
+
+func (s *Service) RenameTable(oldName, newName string) error {
+	q := renameTableQuery(oldName, newName)
+
+	s.log.Debugf("Rename table query: %s", q)
+	_, err := s.q.Exec(q)
+	return err
+}
+
+func (s *Service) RenameColumn(tableName, oldName, newName string) error {
+	q := renameColumnQuery(tableName, oldName, newName)
+
+	s.log.Debugf("Rename column query: %s", q)
+	_, err := s.q.Exec(q)
+	return err
+}
@@ -0,0 +1,252 @@
+// Package dbtest is a database/sql driver for tests, it records the statements it runs
+// and answers queries with the rows set by the test
+package dbtest
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+const (
+	Begin    = "BEGIN"
+	Commit   = "COMMIT"
+	Rollback = "ROLLBACK"
+	// InTx prefixes the statements that ran in a transaction
+	InTx = "tx: "
+)
+
+// Result is the answer to the queries containing Match, the first matching result is used
+type Result struct {
+	Match   string
+	Columns []string
+	Rows    [][]driver.Value
+	Err     error
+}
+
+// Call is a statement with its arguments
+type Call struct {
+	Statement string
+	Args      []driver.Value
+}
+
+// Arg returns the argument of column in an INSERT or UPDATE statement
+func (c Call) Arg(column string) (driver.Value, bool) {
+	statement := strings.TrimPrefix(c.Statement, InTx)
+	switch {
+	case strings.HasPrefix(statement, "INSERT INTO"):
+		start, end := strings.Index(statement, "("), strings.Index(statement, ")")
+		if start < 0 || end < start {
+			return nil, false
+		}
+		for i, name := range strings.Split(statement[start+1:end], ", ") {
+			if strings.Trim(name, `"`) == column && i < len(c.Args) {
+				return c.Args[i], true
+			}
+		}
+
+	case strings.HasPrefix(statement, "UPDATE"):
+		var n int
+		prefix := fmt.Sprintf(`"%s"=$`, column)
+		for _, part := range strings.Fields(statement) {
+			if !strings.HasPrefix(part, prefix) {
+				continue
+			}
+			if _, err := fmt.Sscanf(strings.TrimPrefix(part, prefix), "%d", &n); err == nil && n > 0 && n <= len(c.Args) {
+				return c.Args[n-1], true
+			}
+		}
+	}
+	return nil, false
+}
+
+// DB is the state of one connection pool opened with Open
+type DB struct {
+	mu      sync.Mutex
+	results []Result
+	calls   []Call
+}
+
+var (
+	registerOnce sync.Once
+	dbsMu        sync.Mutex
+	dbs          = make(map[string]*DB)
+)
+
+// Open returns a connection pool on a new fake database
+func Open() (*sql.DB, *DB, error) {
+	registerOnce.Do(func() {
+		sql.Register("dbtest", fakeDriver{})
+	})
+
+	d := &DB{}
+	dbsMu.Lock()
+	name := fmt.Sprintf("db%d", len(dbs))
+	dbs[name] = d
+	dbsMu.Unlock()
+
+	conn, err := sql.Open("dbtest", name)
+	return conn, d, err
+}
+
+// On sets the rows or the error of the queries and statements containing match
+func (d *DB) On(result Result) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.results = append(d.results, result)
+}
+
+// Clear drops the results set by On
+func (d *DB) Clear() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.results = nil
+}
+
+// Statements returns the statements run so far with the transaction markers
+func (d *DB) Statements() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	statements := make([]string, len(d.calls))
+	for i, c := range d.calls {
+		statements[i] = c.Statement
+	}
+	return statements
+}
+
+// Calls returns the statements run so far with their arguments
+func (d *DB) Calls() []Call {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]Call(nil), d.calls...)
+}
+
+// Find returns the calls whose statement contains match
+func (d *DB) Find(match string) []Call {
+	var calls []Call
+	for _, c := range d.Calls() {
+		if strings.Contains(c.Statement, match) {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+func (d *DB) run(query string, args []driver.Value, tx bool) Result {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	statement := strings.Join(strings.Fields(query), " ")
+	if tx {
+		statement = InTx + statement
+	}
+	d.calls = append(d.calls, Call{Statement: statement, Args: args})
+
+	for _, r := range d.results {
+		if strings.Contains(query, r.Match) {
+			return r
+		}
+	}
+	return Result{}
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	dbsMu.Lock()
+	defer dbsMu.Unlock()
+	d, ok := dbs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown database %s", name)
+	}
+	return &conn{db: d}, nil
+}
+
+type conn struct {
+	db *DB
+	tx bool
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return &stmt{conn: c, query: query}, nil
+}
+
+func (c *conn) Close() error {
+	return nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	if r := c.db.run(Begin, nil, false); r.Err != nil {
+		return nil, r.Err
+	}
+	c.tx = true
+	return &tx{conn: c}, nil
+}
+
+type tx struct {
+	conn *conn
+}
+
+func (t *tx) Commit() error {
+	t.conn.tx = false
+	return t.conn.db.run(Commit, nil, false).Err
+}
+
+func (t *tx) Rollback() error {
+	t.conn.tx = false
+	return t.conn.db.run(Rollback, nil, false).Err
+}
+
+type stmt struct {
+	conn  *conn
+	query string
+}
+
+func (s *stmt) Close() error {
+	return nil
+}
+
+func (s *stmt) NumInput() int {
+	return -1
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	if r := s.conn.db.run(s.query, args, s.conn.tx); r.Err != nil {
+		return nil, r.Err
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	r := s.conn.db.run(s.query, args, s.conn.tx)
+	if r.Err != nil {
+		return nil, r.Err
+	}
+	return &rows{columns: r.Columns, values: r.Rows}, nil
+}
+
+type rows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *rows) Columns() []string {
+	return r.columns
+}
+
+func (r *rows) Close() error {
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
@@ -0,0 +1,75 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+
+	"juno-contracts-worker/db/model"
+	"juno-contracts-worker/utils"
+)
+
+// Statements of the schema changes made by the service, names are expected to be shortened already.
+// They are shared with MigrationWriter so exported migrations match what runs at runtime.
+
+func createTableQuery(tableName string, fields model.Fields) string {
+	return fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS %s (
+		id UUID PRIMARY KEY%s
+	);`, table(tableName), fields.CreateTableString())
+}
+
+func dropTableQuery(tableName string) string {
+	return fmt.Sprintf(`DROP TABLE IF EXISTS %s;`, table(tableName))
+}
+
+func createColumnQuery(tableName, columnName, columnType string) string {
+	return fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s;`,
+		table(tableName), utils.QuoteIdentifier(columnName), columnType)
+}
+
+func dropColumnQuery(tableName, columnName string) string {
+	return fmt.Sprintf(`ALTER TABLE %s DROP COLUMN IF EXISTS %s;`,
+		table(tableName), utils.QuoteIdentifier(columnName))
+}
+
+func addColumnQuery(idxName, parentTableName, tableName string) string {
+	return fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s UUID REFERENCES %s;`,
+		table(parentTableName), utils.QuoteIdentifier(idxName), table(tableName))
+}
+
+func createUniqueIndexQuery(columns []string, indexName, tableName string) string {
+	return fmt.Sprintf(`CREATE UNIQUE INDEX IF NOT EXISTS %s ON %s(%s);`,
+		utils.QuoteIdentifier(indexName), table(tableName), strings.Join(utils.QuoteIdentifiers(columns), ", "))
+}
+
+// createIndexQuery builds concurrently, so it does not block writes of the workers indexing the table.
+// It can not run in a transaction. A failed build leaves an INVALID index, which IF NOT EXISTS skips
+// from then on, so it has to be dropped before the index is built again.
+func createIndexQuery(columns []string, indexName, tableName string) string {
+	return fmt.Sprintf(`CREATE INDEX CONCURRENTLY IF NOT EXISTS %s ON %s(%s);`,
+		utils.QuoteIdentifier(indexName), table(tableName), strings.Join(utils.QuoteIdentifiers(columns), ", "))
+}
+
+// dropInvalidIndexQuery drops concurrently like the build, it can not run in a transaction either
+func dropInvalidIndexQuery(indexName string) string {
+	return fmt.Sprintf(`DROP INDEX CONCURRENTLY IF EXISTS %s;`, table(indexName))
+}
+
+func dropIndexQuery(indexName string) string {
+	return fmt.Sprintf(`DROP INDEX IF EXISTS %s;`, table(indexName))
+}
+
+func renameTableQuery(oldName, newName string) string {
+	return fmt.Sprintf(`ALTER TABLE %s RENAME TO %s;`, table(oldName), utils.QuoteIdentifier(newName))
+}
+
+func renameColumnQuery(tableName, oldName, newName string) string {
+	return fmt.Sprintf(`ALTER TABLE %s RENAME COLUMN %s TO %s;`,
+		table(tableName), utils.QuoteIdentifier(oldName), utils.QuoteIdentifier(newName))
+}
+
+func alterColumnTypeQuery(tableName, columnName, columnType string) string {
+	column := utils.QuoteIdentifier(columnName)
+	return fmt.Sprintf(`ALTER TABLE %s ALTER COLUMN %s TYPE %s USING %s::%s;`,
+		table(tableName), column, columnType, column, columnType)
+}
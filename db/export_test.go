@@ -0,0 +1,31 @@
+package db
+
+// helpers of the migrator exposed to the tests of package db_test
+
+func MigrationVersions(dir string) ([]int, error) {
+	migrations, err := readMigrations(dir)
+	return versions(migrations), err
+}
+
+func PendingVersions(dir string, applied map[int]bool) ([]int, error) {
+	migrations, err := readMigrations(dir)
+	return versions(pendingMigrations(migrations, applied)), err
+}
+
+func RevertedVersions(dir string, applied map[int]bool, steps int) ([]int, error) {
+	migrations, err := readMigrations(dir)
+	return versions(revertedMigrations(migrations, applied, steps)), err
+}
+
+func versions(migrations []migration) []int {
+	v := make([]int, len(migrations))
+	for i, m := range migrations {
+		v[i] = m.version
+	}
+	return v
+}
+
+// LimiterSlots is the number of connections the limiter hands out at the moment
+func LimiterSlots(s ServiceInterface) int {
+	return len(s.(*ServiceLimiter).conn)
+}
@@ -2,6 +2,8 @@ package db
 
 import (
 	"database/sql"
+	"sync"
+
 	"juno-contracts-worker/db/model"
 )
 
@@ -47,7 +49,7 @@ func (s *ServiceLimiter) Select(tableName string, fields []string, qParams *mode
 	return s.db.Select(tableName, fields, qParams)
 }
 
-func (s *ServiceLimiter) Update(tableName string, qParams model.QParameters, fields map[string]string) error {
+func (s *ServiceLimiter) Update(tableName string, qParams model.QParameters, fields map[string]any) error {
 	s.conn <- struct{}{}
 	defer func() {
 		<-s.conn
@@ -94,3 +96,79 @@ func (s *ServiceLimiter) LinkTable(id, linkID, idxName, tableName string) error
 	}()
 	return s.db.LinkTable(id, linkID, idxName, tableName)
 }
+
+func (s *ServiceLimiter) ColumnTypes(tableName string) (map[string]string, error) {
+	s.conn <- struct{}{}
+	defer func() {
+		<-s.conn
+	}()
+	return s.db.ColumnTypes(tableName)
+}
+
+func (s *ServiceLimiter) AlterColumnType(tableName, columnName, columnType string) error {
+	s.conn <- struct{}{}
+	defer func() {
+		<-s.conn
+	}()
+	return s.db.AlterColumnType(tableName, columnName, columnType)
+}
+
+func (s *ServiceLimiter) RenameTable(oldName, newName string) error {
+	s.conn <- struct{}{}
+	defer func() {
+		<-s.conn
+	}()
+	return s.db.RenameTable(oldName, newName)
+}
+
+func (s *ServiceLimiter) RenameColumn(tableName, oldName, newName string) error {
+	s.conn <- struct{}{}
+	defer func() {
+		<-s.conn
+	}()
+	return s.db.RenameColumn(tableName, oldName, newName)
+}
+
+func (s *ServiceLimiter) CreateIndex(columns []string, indexName, tableName string) error {
+	s.conn <- struct{}{}
+	defer func() {
+		<-s.conn
+	}()
+	return s.db.CreateIndex(columns, indexName, tableName)
+}
+
+func (s *ServiceLimiter) IndexValid(indexName string) (bool, error) {
+	s.conn <- struct{}{}
+	defer func() {
+		<-s.conn
+	}()
+	return s.db.IndexValid(indexName)
+}
+
+// Begin takes a connection for the whole transaction, statements of the transaction run on it
+// without waiting for the limiter again
+func (s *ServiceLimiter) Begin() (TxInterface, error) {
+	s.conn <- struct{}{}
+	tx, err := s.db.Begin()
+	if err != nil {
+		<-s.conn
+		return nil, err
+	}
+	return &limitedTx{TxInterface: tx, release: func() { <-s.conn }}, nil
+}
+
+type limitedTx struct {
+	TxInterface
+	once    sync.Once
+	release func()
+}
+
+func (t *limitedTx) Commit() error {
+	defer t.once.Do(t.release)
+	return t.TxInterface.Commit()
+}
+
+func (t *limitedTx) Rollback() error {
+	defer t.once.Do(t.release)
+	return t.TxInterface.Rollback()
+}
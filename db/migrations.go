@@ -0,0 +1,451 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+
+	"juno-contracts-worker/db/model"
+	"juno-contracts-worker/utils"
+)
+
+const migrationsTableName = "schema_migrations"
+
+var migrationFileRegex = regexp.MustCompile(`^(\d+)_(.+)\.up\.sql$`)
+
+// migration is a pair of NNNN_name.up.sql and NNNN_name.down.sql files
+type migration struct {
+	version int
+	name    string
+}
+
+func (m migration) path(dir, direction string) string {
+	return filepath.Join(dir, fmt.Sprintf("%04d_%s.%s.sql", m.version, m.name, direction))
+}
+
+// readMigrations lists the migrations of a directory ordered by version
+func readMigrations(dir string) ([]migration, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []migration
+	for _, e := range entries {
+		match := migrationFileRegex.FindStringSubmatch(e.Name())
+		if e.IsDir() || match == nil {
+			continue
+		}
+		version, err := strconv.Atoi(match[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version %s: %w", e.Name(), err)
+		}
+		migrations = append(migrations, migration{version: version, name: match[2]})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+	return migrations, nil
+}
+
+// MigrationWriter runs the schema changes of the wrapped service and writes those that changed
+// the database as numbered up and down migration files, other calls go to the wrapped service
+type MigrationWriter struct {
+	ServiceInterface
+	*migrationFiles
+	// pending keeps the migrations of a transaction until it commits, it is nil outside of one
+	pending *[]pendingMigration
+}
+
+type pendingMigration struct {
+	name, up, down string
+}
+
+// migrationFiles are shared by the writer and the writers of its transactions
+type migrationFiles struct {
+	log *logrus.Logger
+	dir string
+
+	mu      sync.Mutex
+	next    int
+	written map[string]bool
+}
+
+func NewMigrationWriter(db ServiceInterface, log *logrus.Logger, dir string) (ServiceInterface, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("could not create migrations directory %s: %w", dir, err)
+	}
+
+	migrations, err := readMigrations(dir)
+	if err != nil {
+		return nil, fmt.Errorf("could not read migrations from %s: %w", dir, err)
+	}
+
+	w := &MigrationWriter{
+		ServiceInterface: db,
+		migrationFiles: &migrationFiles{
+			log:     log,
+			dir:     dir,
+			next:    1,
+			written: make(map[string]bool),
+		},
+	}
+
+	// statements exported by earlier runs are not written again
+	for _, m := range migrations {
+		up, err := os.ReadFile(m.path(dir, "up"))
+		if err != nil {
+			return nil, err
+		}
+		w.written[strings.TrimSpace(string(up))] = true
+		w.next = m.version + 1
+	}
+
+	return w, nil
+}
+
+// Begin returns a writer of the transaction, its migrations are written when it commits
+func (w *MigrationWriter) Begin() (TxInterface, error) {
+	tx, err := w.ServiceInterface.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &migrationTx{
+		MigrationWriter: &MigrationWriter{
+			ServiceInterface: tx,
+			migrationFiles:   w.migrationFiles,
+			pending:          &[]pendingMigration{},
+		},
+		tx: tx,
+	}, nil
+}
+
+type migrationTx struct {
+	*MigrationWriter
+	tx TxInterface
+}
+
+func (t *migrationTx) Begin() (TxInterface, error) {
+	return t.tx.Begin()
+}
+
+func (t *migrationTx) Commit() error {
+	if err := t.tx.Commit(); err != nil {
+		return err
+	}
+
+	pending := *t.pending
+	*t.pending = nil
+	for _, m := range pending {
+		if err := t.write(m.name, m.up, m.down); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *migrationTx) Rollback() error {
+	*t.pending = nil
+	return t.tx.Rollback()
+}
+
+// export writes the migration of a statement that ran, or keeps it until the transaction commits
+func (w *MigrationWriter) export(name, up, down string) error {
+	if w.pending != nil {
+		*w.pending = append(*w.pending, pendingMigration{name: name, up: up, down: down})
+		return nil
+	}
+	return w.write(name, up, down)
+}
+
+// write is called after the statement ran, the lock is not held while waiting for the database
+func (f *migrationFiles) write(name, up, down string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	up = strings.TrimSpace(up)
+	if f.written[up] {
+		return nil
+	}
+
+	m := migration{version: f.next, name: utils.Identifier(name)}
+	if err := os.WriteFile(m.path(f.dir, "up"), []byte(up+"\n"), 0o644); err != nil {
+		return fmt.Errorf("could not write migration %s: %w", m.path(f.dir, "up"), err)
+	}
+	if err := os.WriteFile(m.path(f.dir, "down"), []byte(strings.TrimSpace(down)+"\n"), 0o644); err != nil {
+		return fmt.Errorf("could not write migration %s: %w", m.path(f.dir, "down"), err)
+	}
+
+	f.log.Infof("Exported migration %04d_%s", m.version, m.name)
+	f.written[up] = true
+	f.next++
+	return nil
+}
+
+func (w *MigrationWriter) CreateTable(tableName string, fields model.Fields) error {
+	exists, err := w.ServiceInterface.TableExists(tableName)
+	if err != nil {
+		return err
+	}
+	if err = w.ServiceInterface.CreateTable(tableName, fields); err != nil || exists {
+		return err
+	}
+
+	short := utils.UniqueShortName(tableName)
+	return w.export("create_"+short, createTableQuery(short, fields), dropTableQuery(short))
+}
+
+func (w *MigrationWriter) CreateColumn(tableName, columnName, columnType string) error {
+	live, err := w.ServiceInterface.ColumnTypes(tableName)
+	if err != nil {
+		return err
+	}
+	if err = w.ServiceInterface.CreateColumn(tableName, columnName, columnType); err != nil {
+		return err
+	}
+	if _, ok := live[utils.Identifier(columnName)]; ok {
+		return nil
+	}
+
+	short := utils.UniqueShortName(tableName)
+	return w.export("add_"+short+"_"+columnName,
+		createColumnQuery(short, columnName, columnType), dropColumnQuery(short, columnName))
+}
+
+func (w *MigrationWriter) AddColumn(idxName, parentTableName, tableName string) error {
+	live, err := w.ServiceInterface.ColumnTypes(parentTableName)
+	if err != nil {
+		return err
+	}
+	if err = w.ServiceInterface.AddColumn(idxName, parentTableName, tableName); err != nil {
+		return err
+	}
+
+	idxName = utils.UniqueShortName(idxName)
+	if _, ok := live[utils.Identifier(idxName)]; ok {
+		return nil
+	}
+
+	tableName = utils.UniqueShortName(tableName)
+	return w.export("add_"+parentTableName+"_"+idxName,
+		addColumnQuery(idxName, parentTableName, tableName), dropColumnQuery(parentTableName, idxName))
+}
+
+func (w *MigrationWriter) AlterColumnType(tableName, columnName, columnType string) error {
+	live, err := w.ServiceInterface.ColumnTypes(tableName)
+	if err != nil {
+		return err
+	}
+	if err = w.ServiceInterface.AlterColumnType(tableName, columnName, columnType); err != nil {
+		return err
+	}
+
+	from := live[utils.Identifier(columnName)]
+	if from == "" || from == columnType {
+		return nil
+	}
+
+	short := utils.UniqueShortName(tableName)
+	return w.export("alter_"+short+"_"+columnName,
+		alterColumnTypeQuery(short, columnName, columnType), alterColumnTypeQuery(short, columnName, from))
+}
+
+func (w *MigrationWriter) CreateUniqueIndex(columns []string, indexName, tableName string) error {
+	if err := w.ServiceInterface.CreateUniqueIndex(columns, indexName, tableName); err != nil {
+		return err
+	}
+
+	indexName, tableName = utils.UniqueShortName(indexName), utils.UniqueShortName(tableName)
+	return w.export("index_"+indexName, createUniqueIndexQuery(columns, indexName, tableName), dropIndexQuery(indexName))
+}
+
+func (w *MigrationWriter) CreateIndex(columns []string, indexName, tableName string) error {
+	if err := w.ServiceInterface.CreateIndex(columns, indexName, tableName); err != nil {
+		return err
+	}
+
+	indexName, tableName = utils.UniqueShortName(indexName), utils.UniqueShortName(tableName)
+	return w.export("index_"+indexName, createIndexQuery(columns, indexName, tableName), dropIndexQuery(indexName))
+}
+
+func (w *MigrationWriter) RenameTable(oldName, newName string) error {
+	if err := w.ServiceInterface.RenameTable(oldName, newName); err != nil {
+		return err
+	}
+
+	return w.export("rename_"+oldName, renameTableQuery(oldName, newName), renameTableQuery(newName, oldName))
+}
+
+func (w *MigrationWriter) RenameColumn(tableName, oldName, newName string) error {
+	if err := w.ServiceInterface.RenameColumn(tableName, oldName, newName); err != nil {
+		return err
+	}
+
+	return w.export("rename_"+tableName+"_"+oldName,
+		renameColumnQuery(tableName, oldName, newName), renameColumnQuery(tableName, newName, oldName))
+}
+
+// Migrator applies and reverts migration files, applied versions are kept in app.schema_migrations.
+// Every file runs outside of a transaction, as concurrent index builds can not run in one.
+type Migrator struct {
+	conn *sql.DB
+	log  *logrus.Logger
+	dir  string
+}
+
+func NewMigrator(log *logrus.Logger, user, password, dbName, dir string) (*Migrator, error) {
+	conn, err := open(user, password, dbName)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		conn: conn,
+		log:  log,
+		dir:  dir,
+	}, nil
+}
+
+func (m *Migrator) Close() {
+	m.conn.Close()
+}
+
+func (m *Migrator) init() error {
+	q := fmt.Sprintf(`CREATE SCHEMA IF NOT EXISTS app;
+	CREATE TABLE IF NOT EXISTS %s (
+		version BIGINT PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	);`, table(migrationsTableName))
+
+	_, err := m.conn.Exec(q)
+	return err
+}
+
+func (m *Migrator) applied() (map[int]bool, error) {
+	var version int
+	rows, err := m.conn.Query(fmt.Sprintf(`SELECT version FROM %s;`, table(migrationsTableName)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]bool)
+	for rows.Next() {
+		if err = rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	return applied, rows.Err()
+}
+
+func (m *Migrator) exec(path string) error {
+	q, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	m.log.Debugf("Migration %s query: %s", filepath.Base(path), q)
+	if _, err = m.conn.Exec(string(q)); err != nil {
+		return fmt.Errorf("could not run migration %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// Up applies the pending migrations in order and returns how many were applied
+func (m *Migrator) Up() (int, error) {
+	migrations, applied, err := m.state()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, mig := range pendingMigrations(migrations, applied) {
+		if err = m.exec(mig.path(m.dir, "up")); err != nil {
+			return count, err
+		}
+
+		q := fmt.Sprintf(`INSERT INTO %s (version, name) VALUES ($1, $2);`, table(migrationsTableName))
+		if _, err = m.conn.Exec(q, mig.version, mig.name); err != nil {
+			return count, fmt.Errorf("could not record migration %d: %w", mig.version, err)
+		}
+		m.log.Infof("Applied migration %04d_%s", mig.version, mig.name)
+		count++
+	}
+
+	return count, nil
+}
+
+// Down reverts the last steps applied migrations and returns how many were reverted
+func (m *Migrator) Down(steps int) (int, error) {
+	migrations, applied, err := m.state()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, mig := range revertedMigrations(migrations, applied, steps) {
+		if err = m.exec(mig.path(m.dir, "down")); err != nil {
+			return count, err
+		}
+
+		q := fmt.Sprintf(`DELETE FROM %s WHERE version = $1;`, table(migrationsTableName))
+		if _, err = m.conn.Exec(q, mig.version); err != nil {
+			return count, fmt.Errorf("could not remove migration %d: %w", mig.version, err)
+		}
+		m.log.Infof("Reverted migration %04d_%s", mig.version, mig.name)
+		count++
+	}
+
+	return count, nil
+}
+
+// pendingMigrations returns the migrations that were not applied yet, in order
+func pendingMigrations(migrations []migration, applied map[int]bool) []migration {
+	var pending []migration
+	for _, mig := range migrations {
+		if !applied[mig.version] {
+			pending = append(pending, mig)
+		}
+	}
+	return pending
+}
+
+// revertedMigrations returns the last steps applied migrations, the latest first
+func revertedMigrations(migrations []migration, applied map[int]bool, steps int) []migration {
+	var reverted []migration
+	for i := len(migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+		if applied[migrations[i].version] {
+			reverted = append(reverted, migrations[i])
+		}
+	}
+	return reverted
+}
+
+func (m *Migrator) state() ([]migration, map[int]bool, error) {
+	migrations, err := readMigrations(m.dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not read migrations from %s: %w", m.dir, err)
+	}
+
+	if err = m.init(); err != nil {
+		return nil, nil, fmt.Errorf("could not create table %s: %w", migrationsTableName, err)
+	}
+
+	applied, err := m.applied()
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not read applied migrations: %w", err)
+	}
+
+	return migrations, applied, nil
+}
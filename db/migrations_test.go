@@ -0,0 +1,223 @@
+package db_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/suite"
+
+	"juno-contracts-worker/db"
+	"juno-contracts-worker/db/model"
+	"juno-contracts-worker/utils"
+)
+
+// fakeService keeps the tables and columns created through it
+type fakeService struct {
+	db.ServiceInterface
+	tables map[string]map[string]string
+}
+
+func (f *fakeService) TableExists(tableName string) (bool, error) {
+	_, ok := f.tables[utils.UniqueShortName(tableName)]
+	return ok, nil
+}
+
+func (f *fakeService) CreateTable(tableName string, fields model.Fields) error {
+	tableName = utils.UniqueShortName(tableName)
+	if _, ok := f.tables[tableName]; !ok {
+		f.tables[tableName] = map[string]string{"id": "UUID"}
+		for k, v := range fields {
+			f.tables[tableName][k] = v.(string)
+		}
+	}
+	return nil
+}
+
+func (f *fakeService) ColumnTypes(tableName string) (map[string]string, error) {
+	columns := make(map[string]string)
+	for k, v := range f.tables[utils.UniqueShortName(tableName)] {
+		columns[k] = v
+	}
+	return columns, nil
+}
+
+func (f *fakeService) CreateColumn(tableName, columnName, columnType string) error {
+	f.tables[utils.UniqueShortName(tableName)][utils.Identifier(columnName)] = columnType
+	return nil
+}
+
+func (f *fakeService) AlterColumnType(tableName, columnName, columnType string) error {
+	return f.CreateColumn(tableName, columnName, columnType)
+}
+
+func (f *fakeService) CreateIndex(columns []string, indexName, tableName string) error {
+	return nil
+}
+
+// fakeTx runs the statements on the fake service, rolled back tables stay
+type fakeTx struct {
+	*fakeService
+}
+
+func (f *fakeService) Begin() (db.TxInterface, error) {
+	return &fakeTx{fakeService: f}, nil
+}
+
+func (t *fakeTx) Commit() error {
+	return nil
+}
+
+func (t *fakeTx) Rollback() error {
+	return nil
+}
+
+type MigrationWriterSuite struct {
+	suite.Suite
+	dir  string
+	fake *fakeService
+	log  *logrus.Logger
+}
+
+func (s *MigrationWriterSuite) SetupTest() {
+	s.dir = s.T().TempDir()
+	s.fake = &fakeService{tables: make(map[string]map[string]string)}
+	s.log = logrus.New()
+	s.log.SetOutput(os.Stderr)
+}
+
+func (s *MigrationWriterSuite) files() []string {
+	entries, err := os.ReadDir(s.dir)
+	s.Require().NoError(err)
+
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func (s *MigrationWriterSuite) read(name string) string {
+	bytes, err := os.ReadFile(filepath.Join(s.dir, name))
+	s.Require().NoError(err)
+	return string(bytes)
+}
+
+func (s *MigrationWriterSuite) TestWritesSchemaChangesOnce() {
+	w, err := db.NewMigrationWriter(s.fake, s.log, s.dir)
+	s.Require().NoError(err)
+
+	fields := model.Fields{"amount": "BIGINT"}
+	s.Require().NoError(w.CreateTable("transfers", fields))
+	s.Require().NoError(w.CreateTable("transfers", fields))
+	s.Require().NoError(w.CreateColumn("transfers", "amount", "BIGINT"))
+	s.Require().NoError(w.CreateColumn("transfers", "amount", "BIGINT"))
+	s.Require().NoError(w.AlterColumnType("transfers", "amount", "NUMERIC"))
+	s.Require().NoError(w.CreateIndex([]string{"amount"}, "transfers_amount_idx", "transfers"))
+	s.Require().NoError(w.CreateIndex([]string{"amount"}, "transfers_amount_idx", "transfers"))
+
+	files := s.files()
+	s.Require().Len(files, 6)
+	s.True(strings.HasPrefix(files[0], "0001_create_transfers."))
+	s.True(strings.HasPrefix(files[2], "0002_alter_transfers_amount."))
+	s.True(strings.HasPrefix(files[4], "0003_index_transfers_amount_idx."))
+
+	s.Contains(s.read(files[0]), `DROP TABLE IF EXISTS app."transfers";`)
+	s.Contains(s.read(files[1]), `CREATE TABLE IF NOT EXISTS app."transfers"`)
+	s.Contains(s.read(files[2]), `TYPE BIGINT`)
+	s.Contains(s.read(files[3]), `TYPE NUMERIC`)
+}
+
+func (s *MigrationWriterSuite) TestContinuesNumbering() {
+	w, err := db.NewMigrationWriter(s.fake, s.log, s.dir)
+	s.Require().NoError(err)
+	s.Require().NoError(w.CreateIndex([]string{"amount"}, "transfers_amount_idx", "transfers"))
+
+	// a new run against an empty database skips statements exported before
+	s.fake.tables = make(map[string]map[string]string)
+	w, err = db.NewMigrationWriter(s.fake, s.log, s.dir)
+	s.Require().NoError(err)
+	s.Require().NoError(w.CreateIndex([]string{"amount"}, "transfers_amount_idx", "transfers"))
+	s.Require().NoError(w.CreateTable("transfers", model.Fields{}))
+
+	files := s.files()
+	s.Require().Len(files, 4)
+	s.True(strings.HasPrefix(files[2], "0002_create_transfers."))
+}
+
+func (s *MigrationWriterSuite) TestWritesTransactionOnCommit() {
+	w, err := db.NewMigrationWriter(s.fake, s.log, s.dir)
+	s.Require().NoError(err)
+
+	tx, err := w.Begin()
+	s.Require().NoError(err)
+	s.Require().NoError(tx.CreateTable("transfers", model.Fields{}))
+	s.Empty(s.files())
+	s.Require().NoError(tx.Rollback())
+	s.Empty(s.files())
+
+	tx, err = w.Begin()
+	s.Require().NoError(err)
+	s.Require().NoError(tx.CreateTable("votes", model.Fields{}))
+	s.Empty(s.files())
+	s.Require().NoError(tx.Commit())
+
+	files := s.files()
+	s.Require().Len(files, 2)
+	s.True(strings.HasPrefix(files[0], "0001_create_votes."))
+}
+
+func TestMigrationWriterSuite(t *testing.T) {
+	suite.Run(t, new(MigrationWriterSuite))
+}
+
+type MigratorSuite struct {
+	suite.Suite
+	dir string
+}
+
+func (s *MigratorSuite) SetupTest() {
+	s.dir = s.T().TempDir()
+	for _, name := range []string{
+		"0010_index_transfers_amount_idx.up.sql",
+		"0010_index_transfers_amount_idx.down.sql",
+		"0002_add_transfers_amount.up.sql",
+		"0002_add_transfers_amount.down.sql",
+		"0001_create_transfers.up.sql",
+		"0001_create_transfers.down.sql",
+		"readme.md",
+	} {
+		s.Require().NoError(os.WriteFile(filepath.Join(s.dir, name), []byte("SELECT 1;\n"), 0o644))
+	}
+	s.Require().NoError(os.Mkdir(filepath.Join(s.dir, "0003_old.up.sql"), 0o755))
+}
+
+func (s *MigratorSuite) TestReadsMigrationsInOrder() {
+	versions, err := db.MigrationVersions(s.dir)
+	s.Require().NoError(err)
+	s.Equal([]int{1, 2, 10}, versions)
+}
+
+func (s *MigratorSuite) TestPendingMigrations() {
+	versions, err := db.PendingVersions(s.dir, map[int]bool{1: true, 10: true})
+	s.Require().NoError(err)
+	s.Equal([]int{2}, versions)
+}
+
+func (s *MigratorSuite) TestDownRevertsLastApplied() {
+	applied := map[int]bool{1: true, 2: true}
+
+	versions, err := db.RevertedVersions(s.dir, applied, 1)
+	s.Require().NoError(err)
+	s.Equal([]int{2}, versions)
+
+	versions, err = db.RevertedVersions(s.dir, applied, 5)
+	s.Require().NoError(err)
+	s.Equal([]int{2, 1}, versions)
+}
+
+func TestMigratorSuite(t *testing.T) {
+	suite.Run(t, new(MigratorSuite))
+}
@@ -3,6 +3,7 @@ package model
 import (
 	"fmt"
 	"juno-contracts-worker/utils"
+	"sort"
 	"strings"
 )
 
@@ -15,60 +16,100 @@ func (f *Fields) CreateTableString() string {
 
 	s := ",\n"
 
-	for k, v := range *f {
+	// sorted keys keep the statement the same for every run, like in exported migrations
+	keys := make([]string, 0, len(*f))
+	for k := range *f {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v := (*f)[k]
 		str := v.(string)
 		if strings.Contains(str, "REFERENCE") {
 			k = utils.UniqueShortName(k)
 		}
+		// constraints like UNIQUE (a, b) are written as they are
+		if !strings.Contains(k, " ") {
+			k = utils.QuoteIdentifier(k)
+		}
 		s += fmt.Sprintf("%s %s,\n", k, v)
 	}
 	return s[0 : len(s)-2]
 }
 
+// QParameters filter and order selected or updated rows. Values of Fields are bound as query
+// parameters, keys of Fields and OrderBy must be valid identifiers.
 type QParameters struct {
 	Limit      *int32
 	StartBlock *int32
 	EndBlock   *int32
-	Fields     *map[string]string
-	OrderBy    *map[string]string
+	Fields     map[string]any
+	OrderBy    []Order
 }
 
-func (q *QParameters) Print() (s string) {
-	if (q.StartBlock != nil && *q.StartBlock != 0) || (q.EndBlock != nil && *q.EndBlock != 0) ||
-		(q.Fields != nil && *q.Fields != nil) {
-		whereStr := []string{}
+type Order struct {
+	Column string
+	Desc   bool
+}
 
-		if q.Fields != nil {
-			for k, v := range *q.Fields {
-				whereStr = append(whereStr, fmt.Sprintf("%s = %s", k, v))
-			}
-		}
+// Build returns the WHERE, ORDER BY and LIMIT clauses with placeholders numbered after offset
+// and the values bound to them
+func (q *QParameters) Build(offset int) (string, []any, error) {
+	var s string
+	var values []any
+	bind := func(v any) string {
+		values = append(values, v)
+		return fmt.Sprintf("$%d", offset+len(values))
+	}
 
-		if q.StartBlock != nil && *q.StartBlock != 0 {
-			whereStr = append(whereStr, fmt.Sprintf("height >= %d", *q.StartBlock))
-		}
+	whereStr := []string{}
+	// sorted keys keep the placeholders in the same order for every query
+	keys := make([]string, 0, len(q.Fields))
+	for k := range q.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
 
-		if q.EndBlock != nil && *q.EndBlock != 0 {
-			whereStr = append(whereStr, fmt.Sprintf("height <= %d", *q.EndBlock))
+	for _, k := range keys {
+		if !utils.IsIdentifier(k) {
+			return "", nil, fmt.Errorf("invalid column name %q", k)
 		}
+		whereStr = append(whereStr, fmt.Sprintf("%s = %s", utils.QuoteIdentifier(k), bind(q.Fields[k])))
+	}
 
-		s += fmt.Sprintf("WHERE %s", strings.Join(whereStr, " AND "))
+	if q.StartBlock != nil && *q.StartBlock != 0 {
+		whereStr = append(whereStr, fmt.Sprintf("height >= %s", bind(*q.StartBlock)))
+	}
+
+	if q.EndBlock != nil && *q.EndBlock != 0 {
+		whereStr = append(whereStr, fmt.Sprintf("height <= %s", bind(*q.EndBlock)))
+	}
 
+	if len(whereStr) > 0 {
+		s += fmt.Sprintf("WHERE %s", strings.Join(whereStr, " AND "))
 	}
 
-	if q.OrderBy != nil {
+	if len(q.OrderBy) > 0 {
 		orderByStr := []string{}
-		for k, v := range *q.OrderBy {
-			orderByStr = append(orderByStr, fmt.Sprintf("%s %s", k, v))
+		for _, o := range q.OrderBy {
+			if !utils.IsIdentifier(o.Column) {
+				return "", nil, fmt.Errorf("invalid column name %q", o.Column)
+			}
+			direction := "ASC"
+			if o.Desc {
+				direction = "DESC"
+			}
+			orderByStr = append(orderByStr, fmt.Sprintf("%s %s", utils.QuoteIdentifier(o.Column), direction))
 		}
 		s += fmt.Sprintf(" ORDER BY %s", strings.Join(orderByStr, ", "))
 	}
 
 	if q.Limit != nil && *q.Limit != 0 {
-		s += fmt.Sprintf(" LIMIT %d ", *q.Limit)
+		s += fmt.Sprintf(" LIMIT %s", bind(*q.Limit))
 	}
 
-	return
+	return s, values, nil
 }
 
 type Unsync struct {
@@ -78,3 +119,157 @@ type Unsync struct {
 	Index  int32
 	TxHash string
 }
+
+type MessageMeta struct {
+	TxSuccess       bool
+	Height          int32
+	TxHash          string
+	MsgIndex        int32
+	Sender          string
+	BlockTime       string
+	Fee             string
+	Memo            string
+	ContractAddress string
+	CodeID          string
+	// RawMsg is the message as received, kept so entity tables can be rebuilt without the chain
+	RawMsg string
+}
+
+// Columns are added to every root entity table next to the message body,
+// the tx_ prefix keeps them apart from keys of the message itself
+func (m *MessageMeta) Columns() map[string]interface{} {
+	return map[string]interface{}{
+		"tx_success":    "BOOLEAN",
+		"tx_height":     "NUMERIC",
+		"tx_hash":       "TEXT",
+		"tx_msg_index":  "INT",
+		"tx_sender":     "TEXT",
+		"tx_block_time": "TIMESTAMPTZ",
+		"tx_fee":        "TEXT",
+		"tx_memo":       "TEXT",
+		"tx_contract":   "TEXT",
+		"raw_msg":       "JSONB",
+	}
+}
+
+func (m *MessageMeta) Values() ([]string, []any) {
+	fields := []string{"tx_success", "tx_height", "tx_hash", "tx_msg_index", "tx_sender", "tx_fee", "tx_memo", "tx_contract"}
+	values := []any{m.TxSuccess, m.Height, m.TxHash, m.MsgIndex, m.Sender, m.Fee, m.Memo, m.ContractAddress}
+
+	if m.BlockTime != "" {
+		fields = append(fields, "tx_block_time")
+		values = append(values, m.BlockTime)
+	}
+
+	if m.RawMsg != "" {
+		fields = append(fields, "raw_msg")
+		values = append(values, m.RawMsg)
+	}
+
+	return fields, values
+}
+
+type Block struct {
+	Height   int64
+	Time     string
+	Hash     string
+	Proposer string
+}
+
+type TxResult struct {
+	Hash      string
+	Height    int64
+	Code      uint32
+	Timestamp string
+	Memo      string
+	Fee       string
+	Events    []Event
+}
+
+type Event struct {
+	MsgIndex   int32
+	Type       string
+	Attributes []Attribute
+}
+
+type Attribute struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// ContractAddressKey is the attribute naming the contract that emitted a wasm event
+const ContractAddressKey = "_contract_address"
+
+// WasmEvents returns the events emitted by contracts for the message, one event per contract
+func (t *TxResult) WasmEvents(msgIndex int32) (events []Event) {
+	for _, e := range t.MsgEvents(msgIndex) {
+		if isWasmEvent(e.Type) {
+			events = append(events, splitByContract(e)...)
+		}
+	}
+	return events
+}
+
+// Value returns the value of the first attribute with key
+func (e Event) Value(key string) string {
+	for _, a := range e.Attributes {
+		if a.Key == key {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func isWasmEvent(eventType string) bool {
+	return eventType == "wasm" || strings.HasPrefix(eventType, "wasm-")
+}
+
+// splitByContract separates events of the same type that the sdk merges into one log entry,
+// every contract starts its own group of attributes with _contract_address
+func splitByContract(e Event) (events []Event) {
+	for _, a := range e.Attributes {
+		if a.Key == ContractAddressKey || len(events) == 0 {
+			events = append(events, Event{MsgIndex: e.MsgIndex, Type: e.Type})
+		}
+		last := &events[len(events)-1]
+		last.Attributes = append(last.Attributes, a)
+	}
+	return events
+}
+
+func (t *TxResult) MsgEvents(msgIndex int32) (events []Event) {
+	for _, e := range t.Events {
+		if e.MsgIndex == msgIndex {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+func (t *TxResult) Attribute(msgIndex int32, eventType, key string) string {
+	for _, e := range t.MsgEvents(msgIndex) {
+		if e.Type != eventType {
+			continue
+		}
+		for _, a := range e.Attributes {
+			if a.Key == key {
+				return a.Value
+			}
+		}
+	}
+	return ""
+}
+
+func (t *TxResult) Attributes(msgIndex int32, eventType, key string) (values []string) {
+	for _, e := range t.MsgEvents(msgIndex) {
+		if e.Type != eventType {
+			continue
+		}
+		for _, a := range e.Attributes {
+			if a.Key == key {
+				values = append(values, a.Value)
+			}
+		}
+	}
+	return values
+}
@@ -0,0 +1,138 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"juno-contracts-worker/db/model"
+)
+
+type QParametersSuite struct {
+	suite.Suite
+}
+
+func (s *QParametersSuite) TestBuild() {
+	start, limit := int32(10), int32(1)
+	q := model.QParameters{
+		Fields:     map[string]any{"name": "x'; DROP TABLE app.sync; --", "sync": false},
+		StartBlock: &start,
+		OrderBy:    []model.Order{{Column: "height", Desc: true}, {Column: "index"}},
+		Limit:      &limit,
+	}
+
+	clauses, values, err := q.Build(1)
+	s.Require().NoError(err)
+	s.Equal(`WHERE "name" = $2 AND "sync" = $3 AND height >= $4 ORDER BY "height" DESC, "index" ASC LIMIT $5`, clauses)
+	s.Equal([]any{"x'; DROP TABLE app.sync; --", false, int32(10), int32(1)}, values)
+}
+
+func (s *QParametersSuite) TestBuildEmpty() {
+	clauses, values, err := (&model.QParameters{}).Build(0)
+	s.Require().NoError(err)
+	s.Empty(clauses)
+	s.Empty(values)
+}
+
+func (s *QParametersSuite) TestInvalidIdentifiers() {
+	_, _, err := (&model.QParameters{Fields: map[string]any{`id" = id OR "1`: 1}}).Build(0)
+	s.Error(err)
+
+	_, _, err = (&model.QParameters{OrderBy: []model.Order{{Column: "height; DROP"}}}).Build(0)
+	s.Error(err)
+}
+
+func TestQParametersSuite(t *testing.T) {
+	suite.Run(t, new(QParametersSuite))
+}
+
+type EventsSuite struct {
+	suite.Suite
+}
+
+func attrs(pairs ...string) []model.Attribute {
+	var attributes []model.Attribute
+	for i := 0; i+1 < len(pairs); i += 2 {
+		attributes = append(attributes, model.Attribute{Key: pairs[i], Value: pairs[i+1]})
+	}
+	return attributes
+}
+
+func (s *EventsSuite) TestWasmEvents() {
+	tests := []struct {
+		name   string
+		events []model.Event
+		want   []model.Event
+	}{
+		{
+			name: "one contract",
+			events: []model.Event{
+				{MsgIndex: 0, Type: "wasm", Attributes: attrs("_contract_address", "juno1a", "action", "transfer")},
+			},
+			want: []model.Event{
+				{MsgIndex: 0, Type: "wasm", Attributes: attrs("_contract_address", "juno1a", "action", "transfer")},
+			},
+		},
+		{
+			name: "merged contracts are split",
+			events: []model.Event{
+				{MsgIndex: 0, Type: "wasm", Attributes: attrs("_contract_address", "juno1a", "action", "send", "_contract_address", "juno1b", "action", "receive")},
+			},
+			want: []model.Event{
+				{MsgIndex: 0, Type: "wasm", Attributes: attrs("_contract_address", "juno1a", "action", "send")},
+				{MsgIndex: 0, Type: "wasm", Attributes: attrs("_contract_address", "juno1b", "action", "receive")},
+			},
+		},
+		{
+			name: "attributes before the first contract",
+			events: []model.Event{
+				{MsgIndex: 0, Type: "wasm", Attributes: attrs("action", "x", "_contract_address", "juno1a", "action", "y")},
+			},
+			want: []model.Event{
+				{MsgIndex: 0, Type: "wasm", Attributes: attrs("action", "x")},
+				{MsgIndex: 0, Type: "wasm", Attributes: attrs("_contract_address", "juno1a", "action", "y")},
+			},
+		},
+		{
+			name: "custom wasm events",
+			events: []model.Event{
+				{MsgIndex: 0, Type: "wasm-proposal", Attributes: attrs("_contract_address", "juno1a", "proposal_id", "1")},
+			},
+			want: []model.Event{
+				{MsgIndex: 0, Type: "wasm-proposal", Attributes: attrs("_contract_address", "juno1a", "proposal_id", "1")},
+			},
+		},
+		{
+			name: "other types and messages are left out",
+			events: []model.Event{
+				{MsgIndex: 0, Type: "transfer", Attributes: attrs("recipient", "juno1a")},
+				{MsgIndex: 0, Type: "wasmx", Attributes: attrs("_contract_address", "juno1a")},
+				{MsgIndex: 1, Type: "wasm", Attributes: attrs("_contract_address", "juno1b")},
+			},
+		},
+		{
+			name: "no attributes",
+			events: []model.Event{
+				{MsgIndex: 0, Type: "wasm"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			tx := &model.TxResult{Events: tt.events}
+			s.Equal(tt.want, tx.WasmEvents(0))
+		})
+	}
+}
+
+func (s *EventsSuite) TestValue() {
+	e := model.Event{Type: "wasm", Attributes: attrs("_contract_address", "juno1a", "amount", "1", "amount", "2")}
+	s.Equal("juno1a", e.Value(model.ContractAddressKey))
+	s.Equal("1", e.Value("amount"))
+	s.Empty(e.Value("to"))
+}
+
+func TestEventsSuite(t *testing.T) {
+	suite.Run(t, new(EventsSuite))
+}
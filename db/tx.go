@@ -0,0 +1,82 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"juno-contracts-worker/utils"
+)
+
+// Tx runs the statements of the service in a transaction. Concurrent index builds can not run
+// in a transaction, so they are queued and run on the connection pool after the commit.
+type Tx struct {
+	*Service
+	tx      *sql.Tx
+	indexes []queuedIndex
+}
+
+type queuedIndex struct {
+	name  string
+	query string
+}
+
+func (s *Service) Begin() (TxInterface, error) {
+	tx, err := s.conn.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("could not begin transaction: %w", err)
+	}
+
+	return &Tx{
+		Service: &Service{
+			conn: s.conn,
+			q:    tx,
+			log:  s.log,
+		},
+		tx: tx,
+	}, nil
+}
+
+func (t *Tx) Begin() (TxInterface, error) {
+	return nil, errors.New("nested transactions are not supported")
+}
+
+// Close leaves the connection pool open, the transaction ends with Commit or Rollback
+func (t *Tx) Close() {}
+
+func (t *Tx) CreateIndex(columns []string, indexName, tableName string) error {
+	indexName = utils.UniqueShortName(indexName)
+	tableName = utils.UniqueShortName(tableName)
+	for _, index := range t.indexes {
+		if index.name == indexName {
+			return nil
+		}
+	}
+	t.indexes = append(t.indexes, queuedIndex{name: indexName, query: createIndexQuery(columns, indexName, tableName)})
+	return nil
+}
+
+func (t *Tx) Commit() error {
+	if err := t.tx.Commit(); err != nil {
+		return fmt.Errorf("could not commit transaction: %w", err)
+	}
+
+	// the data is committed already, so a failed build is only logged. The indexer caches an index once it is
+	// valid and queues it again with the next message of the table, buildIndex drops the invalid one first.
+	for _, index := range t.indexes {
+		if err := t.buildIndex(t.conn, index.name, index.query); err != nil {
+			t.log.Errorf("could not create index: %v", err)
+		}
+	}
+	t.indexes = nil
+
+	return nil
+}
+
+func (t *Tx) Rollback() error {
+	t.indexes = nil
+	if err := t.tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+		return fmt.Errorf("could not roll back transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package db_test
+
+import (
+	"database/sql/driver"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/suite"
+
+	"juno-contracts-worker/db"
+	"juno-contracts-worker/db/dbtest"
+)
+
+type TxSuite struct {
+	suite.Suite
+	fake    *dbtest.DB
+	service db.ServiceInterface
+}
+
+func (s *TxSuite) SetupTest() {
+	conn, fake, err := dbtest.Open()
+	s.Require().NoError(err)
+
+	log := logrus.New()
+	log.SetOutput(os.Stderr)
+	s.fake = fake
+	s.service = db.NewWithConn(log, conn)
+}
+
+func (s *TxSuite) TestCommitBuildsIndexesAfterCommit() {
+	tx, err := s.service.Begin()
+	s.Require().NoError(err)
+
+	s.Require().NoError(tx.CreateIndex([]string{"amount"}, "transfers_amount_idx", "transfers"))
+	s.Require().NoError(tx.Insert("transfers", []string{"id", "amount"}, []any{"1", 5}))
+	s.Require().NoError(tx.Commit())
+
+	s.Equal([]string{
+		dbtest.Begin,
+		dbtest.InTx + `INSERT INTO app."transfers" ("id", "amount") VALUES ($1, $2) ON CONFLICT DO NOTHING;`,
+		dbtest.Commit,
+		`SELECT indisvalid FROM pg_index WHERE indexrelid = to_regclass($1);`,
+		`CREATE INDEX CONCURRENTLY IF NOT EXISTS "transfers_amount_idx" ON app."transfers"("amount");`,
+	}, s.fake.Statements())
+}
+
+func (s *TxSuite) TestCommitBuildsQueuedIndexOnce() {
+	tx, err := s.service.Begin()
+	s.Require().NoError(err)
+
+	s.Require().NoError(tx.CreateIndex([]string{"amount"}, "transfers_amount_idx", "transfers"))
+	s.Require().NoError(tx.CreateIndex([]string{"amount"}, "transfers_amount_idx", "transfers"))
+	s.Require().NoError(tx.Commit())
+
+	s.Len(s.fake.Find("CREATE INDEX"), 1)
+}
+
+func (s *TxSuite) TestInvalidIndexIsDroppedBeforeBuild() {
+	s.fake.On(dbtest.Result{Match: "FROM pg_index", Columns: []string{"indisvalid"}, Rows: [][]driver.Value{{false}}})
+	tx, err := s.service.Begin()
+	s.Require().NoError(err)
+
+	s.Require().NoError(tx.CreateIndex([]string{"amount"}, "transfers_amount_idx", "transfers"))
+	s.Require().NoError(tx.Commit())
+
+	s.Equal([]string{
+		dbtest.Begin,
+		dbtest.Commit,
+		`SELECT indisvalid FROM pg_index WHERE indexrelid = to_regclass($1);`,
+		`DROP INDEX CONCURRENTLY IF EXISTS app."transfers_amount_idx";`,
+		`CREATE INDEX CONCURRENTLY IF NOT EXISTS "transfers_amount_idx" ON app."transfers"("amount");`,
+	}, s.fake.Statements())
+}
+
+func (s *TxSuite) TestValidIndexIsKept() {
+	s.fake.On(dbtest.Result{Match: "FROM pg_index", Columns: []string{"indisvalid"}, Rows: [][]driver.Value{{true}}})
+
+	valid, err := s.service.IndexValid("transfers_amount_idx")
+	s.Require().NoError(err)
+	s.True(valid)
+
+	s.Require().NoError(s.service.CreateIndex([]string{"amount"}, "transfers_amount_idx", "transfers"))
+	s.Empty(s.fake.Find("DROP INDEX"))
+}
+
+func (s *TxSuite) TestMissingIndexIsNotValid() {
+	valid, err := s.service.IndexValid("transfers_amount_idx")
+	s.Require().NoError(err)
+	s.False(valid)
+}
+
+func (s *TxSuite) TestRollbackDropsIndexes() {
+	tx, err := s.service.Begin()
+	s.Require().NoError(err)
+
+	s.Require().NoError(tx.CreateIndex([]string{"amount"}, "transfers_amount_idx", "transfers"))
+	s.Require().NoError(tx.Rollback())
+	s.Require().NoError(tx.Rollback())
+
+	s.Equal([]string{dbtest.Begin, dbtest.Rollback}, s.fake.Statements())
+}
+
+func (s *TxSuite) TestNestedBegin() {
+	tx, err := s.service.Begin()
+	s.Require().NoError(err)
+	defer tx.Rollback()
+
+	_, err = tx.Begin()
+	s.Error(err)
+}
+
+func (s *TxSuite) TestLimiterHoldsSlotUntilCommit() {
+	limiter := db.NewServiceWithConnectionLimiter(s.service)
+
+	tx, err := limiter.Begin()
+	s.Require().NoError(err)
+	s.Equal(1, db.LimiterSlots(limiter))
+
+	s.Require().NoError(tx.Commit())
+	s.Equal(0, db.LimiterSlots(limiter))
+
+	// the slot is released once, even when the transaction ends twice
+	s.Require().NoError(tx.Rollback())
+	s.Equal(0, db.LimiterSlots(limiter))
+}
+
+func (s *TxSuite) TestLimiterReleasesSlotOnFailedCommit() {
+	s.fake.On(dbtest.Result{Match: dbtest.Commit, Err: errors.New("connection lost")})
+	limiter := db.NewServiceWithConnectionLimiter(s.service)
+
+	tx, err := limiter.Begin()
+	s.Require().NoError(err)
+
+	s.Error(tx.Commit())
+	s.Equal(0, db.LimiterSlots(limiter))
+}
+
+func TestTxSuite(t *testing.T) {
+	suite.Run(t, new(TxSuite))
+}
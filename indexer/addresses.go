@@ -0,0 +1,131 @@
+package indexer
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"juno-contracts-worker/db/model"
+	"juno-contracts-worker/utils"
+)
+
+const addressRefsTableName = "address_refs"
+
+// addressRef is an address found in a column of an entity table
+type addressRef struct {
+	address string
+	prefix  string
+	table   string
+	column  string
+}
+
+func (s *Service) initAddressRefs() error {
+	refFields := map[string]interface{}{
+		"address":     "TEXT",
+		"prefix":      "TEXT",
+		"entity":      "TEXT",
+		"column_name": "TEXT",
+		"entity_id":   "TEXT",
+		"code_id":     "TEXT",
+		"tx_hash":     "TEXT",
+		"tx_height":   "NUMERIC",
+	}
+
+	if err := s.db.CreateTable(addressRefsTableName, refFields); err != nil {
+		return fmt.Errorf("could not create table %s: %w", addressRefsTableName, err)
+	}
+
+	if err := s.db.CreateIndex([]string{"address"}, addressRefsTableName+"_address_idx", addressRefsTableName); err != nil {
+		return fmt.Errorf("could not create index on table %s: %w", addressRefsTableName, err)
+	}
+
+	return nil
+}
+
+// findAddresses walks the message like generateTablesForEntity and returns the bech32 addresses with their columns
+func (s *Service) findAddresses(msg map[string]interface{}, name string) []addressRef {
+	var refs []addressRef
+	name = utils.DeleteS(name)
+
+	for k, v := range msg {
+		column := s.knownColumnName(name, k)
+
+		switch val := v.(type) {
+		case string:
+			if prefix, ok := utils.AddressPrefix(val); ok {
+				refs = append(refs, addressRef{address: val, prefix: prefix, table: name, column: column})
+			}
+
+		case map[string]interface{}:
+			// payloads of enums are saved in the JSONB column of the field
+			if s.isEnum(name, column, val) {
+				for _, ref := range s.findAddresses(val, name) {
+					refs = append(refs, addressRef{address: ref.address, prefix: ref.prefix, table: name, column: column})
+				}
+				continue
+			}
+			refs = append(refs, s.findAddresses(val, nestedName(name, k))...)
+
+		case []interface{}:
+			for _, e := range val {
+				switch elem := e.(type) {
+				case string:
+					if prefix, ok := utils.AddressPrefix(elem); ok {
+						refs = append(refs, addressRef{address: elem, prefix: prefix, table: name, column: column})
+					}
+				case map[string]interface{}:
+					refs = append(refs, s.findAddresses(elem, nestedName(name, k))...)
+				}
+			}
+		}
+	}
+
+	return refs
+}
+
+// saveAddressRefs indexes address columns and records where each address appeared
+func (s *Service) saveAddressRefs(msg map[string]interface{}, name, entityID string, meta *model.MessageMeta) error {
+	refs := s.findAddresses(msg, name)
+
+	var codeID, txHash string
+	var height int32
+	var msgIndex int32
+	if meta != nil {
+		codeID, txHash, height, msgIndex = meta.CodeID, meta.TxHash, meta.Height, meta.MsgIndex
+		for column, address := range map[string]string{"tx_sender": meta.Sender, "tx_contract": meta.ContractAddress} {
+			if prefix, ok := utils.AddressPrefix(address); ok {
+				refs = append(refs, addressRef{address: address, prefix: prefix, table: utils.DeleteS(name), column: column})
+			}
+		}
+	}
+
+	for _, ref := range refs {
+		if err := s.indexAddressColumn(ref.table, ref.column); err != nil {
+			return err
+		}
+
+		id := uuid.NewSHA1(uuid.NameSpaceOID, []byte(fmt.Sprintf("%s/%s/%s/%s/%s/%d",
+			addressRefsTableName, ref.address, ref.table, ref.column, txHash, msgIndex)))
+		fields := []string{"id", "address", "prefix", "entity", "column_name", "entity_id", "code_id", "tx_hash", "tx_height"}
+		values := []any{id, ref.address, ref.prefix, ref.table, ref.column, entityID, codeID, txHash, height}
+		if err := s.db.Insert(addressRefsTableName, fields, values); err != nil {
+			return fmt.Errorf("could not save address %s of %s: %w", ref.address, ref.table, err)
+		}
+	}
+
+	return nil
+}
+
+// indexAddressColumn indexes text columns holding addresses, array columns are left to address_refs
+func (s *Service) indexAddressColumn(tableName, column string) error {
+	live, err := s.columnTypes(tableName)
+	if err != nil {
+		return fmt.Errorf("could not read column types of %s: %w", tableName, err)
+	}
+
+	if live[column] != "TEXT" {
+		return nil
+	}
+
+	return s.ensureIndex(tableName, []string{column})
+}
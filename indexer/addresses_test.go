@@ -0,0 +1,140 @@
+package indexer_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/cosmos/cosmos-sdk/types/bech32"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/suite"
+
+	"juno-contracts-worker/config"
+	"juno-contracts-worker/db"
+	"juno-contracts-worker/db/dbtest"
+	"juno-contracts-worker/db/model"
+	"juno-contracts-worker/indexer"
+)
+
+type AddressesSuite struct {
+	suite.Suite
+	fake    *dbtest.DB
+	indexer *indexer.Service
+}
+
+func (s *AddressesSuite) SetupTest() {
+	conn, fake, err := dbtest.Open()
+	s.Require().NoError(err)
+	s.fake = fake
+
+	log := logrus.New()
+	log.SetOutput(os.Stderr)
+	s.indexer = indexer.New(nil, db.NewWithConn(log, conn), log, &config.Config{})
+}
+
+// address returns a valid bech32 address with prefix, seed varies the data
+func (s *AddressesSuite) address(prefix string, seed byte) string {
+	data := make([]byte, 20)
+	for i := range data {
+		data[i] = seed
+	}
+	address, err := bech32.ConvertAndEncode(prefix, data)
+	s.Require().NoError(err)
+	return address
+}
+
+func (s *AddressesSuite) TestFindAddresses() {
+	juno, cosmos, valoper := s.address("juno", 1), s.address("cosmos", 2), s.address("junovaloper", 3)
+	// the last character breaks the checksum
+	broken := juno[:len(juno)-1] + "q"
+	if broken == juno {
+		broken = juno[:len(juno)-1] + "p"
+	}
+
+	tests := []struct {
+		name string
+		msg  map[string]interface{}
+		refs []indexer.AddressRef
+	}{
+		{
+			name: "top level",
+			msg:  map[string]interface{}{"recipient": juno, "amount": "10"},
+			refs: []indexer.AddressRef{{Address: juno, Prefix: "juno", Table: "entity", Column: "recipient"}},
+		},
+		{
+			name: "other prefixes",
+			msg:  map[string]interface{}{"owner": cosmos, "validator": valoper},
+			refs: []indexer.AddressRef{
+				{Address: cosmos, Prefix: "cosmos", Table: "entity", Column: "owner"},
+				{Address: valoper, Prefix: "junovaloper", Table: "entity", Column: "validator"},
+			},
+		},
+		{
+			name: "nested object",
+			msg:  map[string]interface{}{"config": map[string]interface{}{"admin": juno}},
+			refs: []indexer.AddressRef{{Address: juno, Prefix: "juno", Table: "entity_config", Column: "admin"}},
+		},
+		{
+			name: "array of addresses",
+			msg:  map[string]interface{}{"members": []interface{}{juno, "nobody"}},
+			refs: []indexer.AddressRef{{Address: juno, Prefix: "juno", Table: "entity", Column: "member"}},
+		},
+		{
+			name: "array of objects",
+			msg:  map[string]interface{}{"balances": []interface{}{map[string]interface{}{"owner": cosmos, "amount": "1"}}},
+			refs: []indexer.AddressRef{{Address: cosmos, Prefix: "cosmos", Table: "entity_balance", Column: "owner"}},
+		},
+		{
+			name: "deeply nested",
+			msg: map[string]interface{}{"a": map[string]interface{}{"b": map[string]interface{}{"c": []interface{}{
+				map[string]interface{}{"to": juno},
+			}}}},
+			refs: []indexer.AddressRef{{Address: juno, Prefix: "juno", Table: "entity_a_b_c", Column: "to"}},
+		},
+		{
+			name: "broken checksum",
+			msg:  map[string]interface{}{"recipient": broken},
+		},
+		{
+			name: "no separator",
+			msg:  map[string]interface{}{"recipient": "junoqyqszqgpqyqszqgpqyqszqgpqyqszqgpqyqszqgp"},
+		},
+		{
+			name: "invalid prefix character",
+			msg:  map[string]interface{}{"recipient": "ju no1qyqszqgpqyqszqgpqyqszqgpqyqszqgpxyz"},
+		},
+		{
+			name: "too short",
+			msg:  map[string]interface{}{"recipient": "juno1abc"},
+		},
+		{
+			name: "numbers and text",
+			msg:  map[string]interface{}{"amount": "1000000", "memo": "hello", "height": float64(5)},
+		},
+	}
+
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			s.ElementsMatch(tt.refs, s.indexer.FindAddresses(tt.msg, "entity"))
+		})
+	}
+}
+
+func (s *AddressesSuite) TestEnumPayloadAddressesUseTheEnumColumn() {
+	cw20 := s.address("juno", 4)
+	msg := `{"codeId": "42", "sender": "juno1", "msg": {"config": {"denom": {"cw20": "` + cw20 + `"}}}}`
+	meta := &model.MessageMeta{TxSuccess: true, Height: 100, TxHash: "T"}
+	s.Require().NoError(s.indexer.SaveJsonAsEntity("m1", "msg_instantiate_contract", msg, meta))
+
+	var columns []string
+	for _, c := range s.fake.Find(`INSERT INTO app."address_refs"`) {
+		if address, _ := c.Arg("address"); address == cw20 {
+			column, _ := c.Arg("column_name")
+			columns = append(columns, column.(string))
+		}
+	}
+	s.Equal([]string{"denom"}, columns)
+}
+
+func TestAddressesSuite(t *testing.T) {
+	suite.Run(t, new(AddressesSuite))
+}
@@ -0,0 +1,93 @@
+package indexer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+)
+
+const (
+	decodedSuffix = "_decoded"
+	// maxBinaryDepth stops decoding of payloads nested deeper than any real contract sends
+	maxBinaryDepth = 8
+)
+
+// decodeBinaries adds the decoded JSON of base64 Binary fields next to them as <key>_decoded,
+// so they are saved as child entities while the original string stays in its column
+func (s *Service) decodeBinaries(msg map[string]interface{}, depth int) {
+	if depth > maxBinaryDepth {
+		return
+	}
+
+	// keys added while ranging over the map may or may not be visited, so they are added after the loop
+	decodedFields := make(map[string]interface{})
+	for k, v := range msg {
+		switch val := v.(type) {
+		case string:
+			if !s.binaryField(k) {
+				continue
+			}
+			if _, ok := msg[k+decodedSuffix]; ok {
+				continue
+			}
+			decoded, ok := decodeBinaryJson(val)
+			if !ok {
+				continue
+			}
+			s.decodeBinaries(decoded, depth+1)
+			decodedFields[k+decodedSuffix] = decoded
+
+		case map[string]interface{}:
+			s.decodeBinaries(val, depth)
+
+		case []interface{}:
+			for _, e := range val {
+				if m, ok := e.(map[string]interface{}); ok {
+					s.decodeBinaries(m, depth)
+				}
+			}
+		}
+	}
+
+	for k, v := range decodedFields {
+		msg[k] = v
+	}
+}
+
+func (s *Service) binaryField(key string) bool {
+	if s.cfg.DetectBinary {
+		return true
+	}
+	for _, field := range s.cfg.BinaryFieldNames() {
+		if field == key {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeBinaryJson decodes strings holding base64 encoded JSON objects
+func decodeBinaryJson(s string) (map[string]interface{}, bool) {
+	if len(s) < 4 || len(s)%4 != 0 {
+		return nil, false
+	}
+
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, false
+	}
+
+	data = bytes.TrimSpace(data)
+	if len(data) < 2 || data[0] != '{' {
+		return nil, false
+	}
+
+	var decoded map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err = decoder.Decode(&decoded); err != nil {
+		return nil, false
+	}
+
+	return decoded, true
+}
@@ -0,0 +1,53 @@
+package indexer_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"juno-contracts-worker/indexer"
+)
+
+type BinarySuite struct {
+	suite.Suite
+}
+
+func encode(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+func (s *BinarySuite) TestDecodeBinaryJson() {
+	tests := []struct {
+		name    string
+		value   string
+		decoded map[string]interface{}
+	}{
+		{"object", encode(`{"transfer": {"amount": "10"}}`), map[string]interface{}{"transfer": map[string]interface{}{"amount": "10"}}},
+		{"numbers are kept", encode(`{"stake": {"height": 12345678901234567890}}`), map[string]interface{}{"stake": map[string]interface{}{"height": json.Number("12345678901234567890")}}},
+		{"surrounding whitespace", encode("\n {\"a\": 1} \n"), map[string]interface{}{"a": json.Number("1")}},
+		{"nested binary stays a string", encode(`{"msg": "` + encode(`{"a": 1}`) + `"}`), map[string]interface{}{"msg": encode(`{"a": 1}`)}},
+		{"plain text", encode("hello world!"), nil},
+		{"json array", encode(`[{"a": 1}]`), nil},
+		{"json string", encode(`"abc"`), nil},
+		{"broken json", encode(`{"a": `), nil},
+		{"binary data", base64.StdEncoding.EncodeToString([]byte{0xff, 0x00, 0x7b, 0x10}), nil},
+		{"address", "juno1qyqszqgpqyqszqgpqyqszqgpqyqszqgp", nil},
+		{"bad padding", "eyJhIjoxfQ", nil},
+		{"short string", "ab", nil},
+		{"empty", "", nil},
+	}
+
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			decoded, ok := indexer.DecodeBinaryJson(tt.value)
+			s.Equal(tt.decoded != nil, ok)
+			s.Equal(tt.decoded, decoded)
+		})
+	}
+}
+
+func TestBinarySuite(t *testing.T) {
+	suite.Run(t, new(BinarySuite))
+}
@@ -0,0 +1,73 @@
+package indexer
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"juno-contracts-worker/db/model"
+)
+
+const blocksTableName = "blocks"
+
+func (s *Service) initBlocksTable() error {
+	blockFields := map[string]interface{}{
+		"height":   "NUMERIC",
+		"time":     "TIMESTAMPTZ",
+		"hash":     "TEXT",
+		"proposer": "TEXT",
+	}
+
+	if err := s.db.CreateTable(blocksTableName, blockFields); err != nil {
+		return fmt.Errorf("could not create table %s: %w", blocksTableName, err)
+	}
+
+	if err := s.db.CreateUniqueIndex([]string{"height"}, blocksTableName+"_height_idx", blocksTableName); err != nil {
+		return fmt.Errorf("could not create index on table %s: %w", blocksTableName, err)
+	}
+
+	return nil
+}
+
+// BlockTime returns time of the block at height, headers are fetched from the node once and kept in blocks table
+func (s *Service) BlockTime(height int32) (string, error) {
+	var blockTime sql.NullString
+	fields := []string{"time"}
+	qFields := map[string]any{
+		"height": height,
+	}
+	qParams := &model.QParameters{Fields: qFields}
+
+	rows, err := s.db.Select(blocksTableName, fields, qParams)
+	if err != nil {
+		return "", fmt.Errorf("could not query block %d: %w", height, err)
+	}
+
+	found := rows.Next()
+	if found {
+		err = rows.Scan(&blockTime)
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	// the block is saved on the same connection when it is not known yet
+	rows.Close()
+	if err != nil || found {
+		return blockTime.String, err
+	}
+
+	block, err := s.client.GetBlockByHeight(int64(height))
+	if err != nil {
+		return "", err
+	}
+
+	blockID := uuid.NewSHA1(uuid.NameSpaceOID, []byte(fmt.Sprintf("%s/%d", blocksTableName, block.Height)))
+	fieldNames := []string{"id", "height", "time", "hash", "proposer"}
+	values := []any{blockID, block.Height, block.Time, block.Hash, block.Proposer}
+	if err = s.db.Insert(blocksTableName, fieldNames, values); err != nil {
+		return "", fmt.Errorf("could not save block %d: %w", height, err)
+	}
+
+	return block.Time, nil
+}
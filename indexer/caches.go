@@ -0,0 +1,168 @@
+package indexer
+
+// caches keep what the indexer learned about the schema of the database. A service bound to
+// a transaction keeps its changes in a delta, which is merged into the shared caches after the
+// commit and dropped with a rollback, so other goroutines never see uncommitted changes.
+type caches struct {
+	columns  map[string]map[string]string
+	enums    map[string]bool
+	newEnums map[string][]string
+	indexed  map[string]bool
+	names    map[string]bool
+	schemas  map[string]SchemaVersion
+	// keyColumns and columnKeys map json keys of a table to their columns and back, keyed by table/key and table/column
+	keyColumns map[string]string
+	columnKeys map[string]string
+}
+
+func newCaches() *caches {
+	return &caches{
+		columns:  make(map[string]map[string]string),
+		enums:    make(map[string]bool),
+		newEnums: make(map[string][]string),
+		indexed:  make(map[string]bool),
+		names:    make(map[string]bool),
+		schemas:  make(map[string]SchemaVersion),
+
+		keyColumns: make(map[string]string),
+		columnKeys: make(map[string]string),
+	}
+}
+
+// MergeCaches makes the cache changes of the transaction visible to all goroutines,
+// it is called once the transaction committed
+func (s *Service) MergeCaches() {
+	if s.delta == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for tableName, columns := range s.delta.columns {
+		shared, ok := s.cache.columns[tableName]
+		if !ok {
+			s.cache.columns[tableName] = columns
+			continue
+		}
+		for column, columnType := range columns {
+			shared[column] = columnType
+		}
+	}
+	for key := range s.delta.enums {
+		s.cache.enums[key] = true
+	}
+	for tableName, fields := range s.delta.newEnums {
+		s.cache.newEnums[tableName] = append(s.cache.newEnums[tableName], fields...)
+	}
+	for key := range s.delta.indexed {
+		s.cache.indexed[key] = true
+	}
+	for key := range s.delta.names {
+		s.cache.names[key] = true
+	}
+	for key, schema := range s.delta.schemas {
+		s.cache.schemas[key] = schema
+	}
+	for key, column := range s.delta.keyColumns {
+		s.cache.keyColumns[key] = column
+	}
+	for column, key := range s.delta.columnKeys {
+		s.cache.columnKeys[column] = key
+	}
+
+	s.delta = newCaches()
+}
+
+// writable returns the caches changed by the service, the lock is held by the caller
+func (s *Service) writable() *caches {
+	if s.delta != nil {
+		return s.delta
+	}
+	return s.cache
+}
+
+// cachedColumns returns the columns of the table the service sees, the lock is held by the caller
+func (s *Service) cachedColumns(tableName string) (map[string]string, bool) {
+	if s.delta != nil {
+		if columns, ok := s.delta.columns[tableName]; ok {
+			return columns, true
+		}
+	}
+	columns, ok := s.cache.columns[tableName]
+	return columns, ok
+}
+
+// columnsForUpdate returns the cached columns the service can change, nil when the table is not cached.
+// The lock is held by the caller.
+func (s *Service) columnsForUpdate(tableName string) map[string]string {
+	w := s.writable()
+	if columns, ok := w.columns[tableName]; ok {
+		return columns
+	}
+
+	columns, ok := s.cache.columns[tableName]
+	if !ok {
+		return nil
+	}
+	w.columns[tableName] = copyColumns(columns)
+	return w.columns[tableName]
+}
+
+// cachedFlag reports whether the key is set in the enums, indexed or names caches,
+// get picks the cache. The lock is held by the caller.
+func (s *Service) cachedFlag(get func(*caches) map[string]bool, key string) bool {
+	if s.delta != nil && get(s.delta)[key] {
+		return true
+	}
+	return get(s.cache)[key]
+}
+
+// cachedName returns the column of a key or the key of a column, get picks the cache. The lock is held by the caller.
+func (s *Service) cachedName(get func(*caches) map[string]string, key string) (string, bool) {
+	if s.delta != nil {
+		if name, ok := get(s.delta)[key]; ok {
+			return name, true
+		}
+	}
+	name, ok := get(s.cache)[key]
+	return name, ok
+}
+
+func (s *Service) cachedSchema(key string) (SchemaVersion, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.delta != nil {
+		if schema, ok := s.delta.schemas[key]; ok {
+			return schema, true
+		}
+	}
+	schema, ok := s.cache.schemas[key]
+	return schema, ok
+}
+
+func (s *Service) cacheSchema(key string, schema SchemaVersion) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.writable().schemas[key] = schema
+}
+
+func enumsOf(c *caches) map[string]bool {
+	return c.enums
+}
+
+func indexedOf(c *caches) map[string]bool {
+	return c.indexed
+}
+
+func namesOf(c *caches) map[string]bool {
+	return c.names
+}
+
+func keyColumnsOf(c *caches) map[string]string {
+	return c.keyColumns
+}
+
+func columnKeysOf(c *caches) map[string]string {
+	return c.columnKeys
+}
@@ -0,0 +1,299 @@
+package indexer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"juno-contracts-worker/config"
+	"juno-contracts-worker/db/model"
+	"juno-contracts-worker/utils"
+)
+
+const (
+	typeDecisionsTableName = "type_decisions"
+	quarantineTableName    = "quarantine"
+)
+
+// typeConflict is a column whose live type does not hold the type inferred from a message
+type typeConflict struct {
+	table        string
+	column       string
+	liveType     string
+	inferredType string
+}
+
+func (s *Service) initConflictTables() error {
+	decisionFields := map[string]interface{}{
+		"table_name":    "TEXT",
+		"column_name":   "TEXT",
+		"live_type":     "TEXT",
+		"inferred_type": "TEXT",
+		"policy":        "TEXT",
+		"resolution":    "TEXT",
+		"code_id":       "TEXT",
+		"tx_hash":       "TEXT",
+		"tx_height":     "NUMERIC",
+		"created_at":    "TIMESTAMPTZ DEFAULT now()",
+	}
+	quarantineFields := map[string]interface{}{
+		"entity":        "TEXT",
+		"parent_id":     "TEXT",
+		"table_name":    "TEXT",
+		"column_name":   "TEXT",
+		"live_type":     "TEXT",
+		"inferred_type": "TEXT",
+		"msg":           "JSONB",
+		"code_id":       "TEXT",
+		"tx_hash":       "TEXT",
+		"tx_height":     "NUMERIC",
+	}
+
+	for tableName, fields := range map[string]model.Fields{
+		typeDecisionsTableName: decisionFields,
+		quarantineTableName:    quarantineFields,
+	} {
+		if err := s.db.CreateTable(tableName, fields); err != nil {
+			return fmt.Errorf("could not create table %s: %w", tableName, err)
+		}
+	}
+
+	return nil
+}
+
+// columnTypes returns a copy of the live column types of a table, read once and kept up to date by the indexer
+func (s *Service) columnTypes(tableName string) (map[string]string, error) {
+	tableName = utils.UniqueShortName(tableName)
+
+	s.mu.Lock()
+	columns, ok := s.cachedColumns(tableName)
+	if ok {
+		columns = copyColumns(columns)
+	}
+	s.mu.Unlock()
+	if ok {
+		return columns, nil
+	}
+
+	columns, err := s.db.ColumnTypes(tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.writable().columns[tableName] = copyColumns(columns)
+	return columns, nil
+}
+
+func copyColumns(columns map[string]string) map[string]string {
+	c := make(map[string]string, len(columns))
+	for k, v := range columns {
+		c[k] = v
+	}
+	return c
+}
+
+// rememberColumns adds columns created by the indexer to the cache, types of known columns stay as they are
+func (s *Service) rememberColumns(tableName string, fields map[string]interface{}) {
+	tableName = utils.UniqueShortName(tableName)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	columns := s.columnsForUpdate(tableName)
+	if columns == nil {
+		return
+	}
+
+	for k, v := range fields {
+		if _, known := columns[k]; !known && isPlainColumn(k, v) {
+			columns[k] = v.(string)
+		}
+	}
+}
+
+func (s *Service) setColumnType(tableName, column, columnType string) {
+	tableName = utils.UniqueShortName(tableName)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if columns := s.columnsForUpdate(tableName); columns != nil {
+		columns[column] = columnType
+	}
+}
+
+// isPlainColumn leaves out constraints and references which never change type
+func isPlainColumn(k string, v interface{}) bool {
+	val, ok := v.(string)
+	return ok && !strings.Contains(k, " ") && !strings.Contains(val, "REFERENCES")
+}
+
+func fits(liveType, inferredType string) bool {
+	return utils.WidenType(liveType, inferredType) == liveType
+}
+
+func (s *Service) typeConflicts(order []string, tables map[string]interface{}) ([]typeConflict, error) {
+	var conflicts []typeConflict
+
+	for _, tableName := range order {
+		exists, err := s.TableExists(tableName)
+		if err != nil {
+			return nil, fmt.Errorf("could not verify if table %s exists, err: %w", tableName, err)
+		}
+		if !exists {
+			continue
+		}
+
+		live, err := s.columnTypes(tableName)
+		if err != nil {
+			return nil, fmt.Errorf("could not read column types of %s, err: %w", tableName, err)
+		}
+
+		for k, v := range tables[tableName].(map[string]interface{}) {
+			if !isPlainColumn(k, v) {
+				continue
+			}
+
+			liveType, ok := live[k]
+			if !ok || fits(liveType, v.(string)) {
+				continue
+			}
+
+			conflicts = append(conflicts, typeConflict{
+				table:        tableName,
+				column:       k,
+				liveType:     liveType,
+				inferredType: v.(string),
+			})
+		}
+	}
+
+	return conflicts, nil
+}
+
+// resolveConflicts applies the configured policy, it reports true when the message went to quarantine
+func (s *Service) resolveConflicts(conflicts []typeConflict, msg map[string]interface{}, parentID, name string, meta *model.MessageMeta) (bool, error) {
+	policy := s.cfg.TypeConflictPolicy()
+
+	for _, c := range conflicts {
+		var resolution string
+
+		switch policy {
+		case config.TypeConflictSibling:
+			resolution = utils.SiblingColumn(c.column, c.inferredType)
+			if err := s.db.CreateColumn(c.table, resolution, c.inferredType); err != nil {
+				return false, fmt.Errorf("could not create column %s of %s, err: %w", resolution, c.table, err)
+			}
+			s.setColumnType(c.table, resolution, c.inferredType)
+
+		case config.TypeConflictQuarantine:
+			resolution = quarantineTableName
+
+		default:
+			resolution = utils.WidenType(c.liveType, c.inferredType)
+			if err := s.db.AlterColumnType(c.table, c.column, resolution); err != nil {
+				return false, fmt.Errorf("could not widen column %s of %s, err: %w", c.column, c.table, err)
+			}
+			s.setColumnType(c.table, c.column, resolution)
+		}
+
+		s.log.Infof("Type conflict on %s.%s %s vs %s resolved by %s: %s", c.table, c.column, c.liveType, c.inferredType, policy, resolution)
+		if err := s.saveDecision(c, policy, resolution, meta); err != nil {
+			return false, err
+		}
+	}
+
+	if policy != config.TypeConflictQuarantine || len(conflicts) == 0 {
+		return false, nil
+	}
+
+	return true, s.quarantine(conflicts[0], msg, parentID, name, meta)
+}
+
+func (s *Service) saveDecision(c typeConflict, policy, resolution string, meta *model.MessageMeta) error {
+	fields := []string{"id", "table_name", "column_name", "live_type", "inferred_type", "policy", "resolution"}
+	values := []any{uuid.New(), utils.UniqueShortName(c.table), c.column, c.liveType, c.inferredType, policy, resolution}
+	if meta != nil {
+		fields = append(fields, "code_id", "tx_hash", "tx_height")
+		values = append(values, meta.CodeID, meta.TxHash, meta.Height)
+	}
+
+	if err := s.db.Insert(typeDecisionsTableName, fields, values); err != nil {
+		return fmt.Errorf("could not save type decision for %s.%s, err: %w", c.table, c.column, err)
+	}
+	return nil
+}
+
+// quarantine keeps the whole message aside, its id follows the source row so reprocessing does not duplicate it
+func (s *Service) quarantine(c typeConflict, msg map[string]interface{}, parentID, name string, meta *model.MessageMeta) error {
+	bytes, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("could not marshal quarantined message, err: %w", err)
+	}
+
+	id := uuid.NewSHA1(uuid.NameSpaceOID, []byte(fmt.Sprintf("%s/%s/%s", quarantineTableName, name, parentID)))
+	fields := []string{"id", "entity", "parent_id", "table_name", "column_name", "live_type", "inferred_type", "msg"}
+	values := []any{id, name, parentID, utils.UniqueShortName(c.table), c.column, c.liveType, c.inferredType, string(bytes)}
+	if meta != nil {
+		fields = append(fields, "code_id", "tx_hash", "tx_height")
+		values = append(values, meta.CodeID, meta.TxHash, meta.Height)
+	}
+
+	if err = s.db.Insert(quarantineTableName, fields, values); err != nil {
+		return fmt.Errorf("could not quarantine message %s, err: %w", parentID, err)
+	}
+	return nil
+}
+
+// valueColumn routes a value to the sibling column of its type when the original column does not hold it
+func (s *Service) valueColumn(tableName, field string, v interface{}) string {
+	if s.cfg.TypeConflictPolicy() != config.TypeConflictSibling {
+		return field
+	}
+
+	live, err := s.columnTypes(tableName)
+	if err != nil {
+		s.log.Debugf("Could not read column types of %s: %v", tableName, err)
+		return field
+	}
+
+	types := valueTypes(v)
+	liveType, ok := live[field]
+	if !ok || len(types) == 0 || fits(liveType, types[0]) {
+		return field
+	}
+
+	for _, t := range types {
+		sibling := utils.SiblingColumn(field, t)
+		if _, ok := live[sibling]; ok {
+			return sibling
+		}
+	}
+
+	return field
+}
+
+// valueTypes lists the column types a value can be stored in, narrowest first
+func valueTypes(v interface{}) []string {
+	switch val := v.(type) {
+	case json.Number:
+		return []string{utils.NumberType(val), "NUMERIC", "TEXT"}
+	case string:
+		if utils.IsNumericString(val) {
+			return []string{"NUMERIC", "TEXT"}
+		}
+		return []string{"TEXT"}
+	case bool:
+		return []string{"BOOLEAN", "TEXT"}
+	case []interface{}:
+		switch arrayType := utils.ArrayType(val); arrayType {
+		case utils.ArrayJson:
+			return []string{arrayType, "TEXT"}
+		case utils.ArrayText, utils.ArrayNumeric, utils.ArrayBoolean:
+			return []string{arrayType, "TEXT[]", "TEXT"}
+		}
+	}
+	return nil
+}
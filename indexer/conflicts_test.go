@@ -0,0 +1,113 @@
+package indexer_test
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/suite"
+
+	"juno-contracts-worker/config"
+	"juno-contracts-worker/db"
+	"juno-contracts-worker/db/dbtest"
+	"juno-contracts-worker/db/model"
+	"juno-contracts-worker/indexer"
+)
+
+type ConflictsSuite struct {
+	suite.Suite
+	fake *dbtest.DB
+}
+
+// indexer returns an indexer with the policy whose table amounts has a BIGINT amount and a NUMERIC sibling
+func (s *ConflictsSuite) indexer(policy string) *indexer.Service {
+	conn, fake, err := dbtest.Open()
+	s.Require().NoError(err)
+	s.fake = fake
+	s.fake.On(dbtest.Result{
+		Match:   "FROM information_schema.columns",
+		Columns: []string{"column_name", "udt_name"},
+		Rows:    [][]driver.Value{{"amount", "int8"}, {"amount_numeric", "numeric"}},
+	})
+
+	log := logrus.New()
+	log.SetOutput(os.Stderr)
+	return indexer.New(nil, db.NewWithConn(log, conn), log, &config.Config{TypeConflicts: policy})
+}
+
+func (s *ConflictsSuite) TestResolveConflicts() {
+	tests := []struct {
+		policy      string
+		statement   string
+		resolution  string
+		quarantined bool
+	}{
+		{
+			policy:     "",
+			statement:  `ALTER TABLE app."amounts" ALTER COLUMN "amount" TYPE NUMERIC`,
+			resolution: "NUMERIC",
+		},
+		{
+			policy:     config.TypeConflictWiden,
+			statement:  `ALTER TABLE app."amounts" ALTER COLUMN "amount" TYPE NUMERIC`,
+			resolution: "NUMERIC",
+		},
+		{
+			policy:     config.TypeConflictSibling,
+			statement:  `ALTER TABLE app."amounts" ADD COLUMN IF NOT EXISTS "amount_numeric" NUMERIC`,
+			resolution: "amount_numeric",
+		},
+		{
+			policy:      config.TypeConflictQuarantine,
+			statement:   `INSERT INTO app."quarantine"`,
+			resolution:  "quarantine",
+			quarantined: true,
+		},
+	}
+
+	for _, tt := range tests {
+		s.Run(tt.policy, func() {
+			i := s.indexer(tt.policy)
+			meta := &model.MessageMeta{Height: 100, TxHash: "T", CodeID: "42"}
+
+			quarantined, err := i.ResolveConflict("amounts", "amount", "BIGINT", "NUMERIC", map[string]interface{}{"amount": "1.5"}, meta)
+			s.Require().NoError(err)
+			s.Equal(tt.quarantined, quarantined)
+
+			s.NotEmpty(s.fake.Find(tt.statement), s.fake.Statements())
+			decisions := s.fake.Find(`INSERT INTO app."type_decisions"`)
+			s.Require().Len(decisions, 1)
+			resolution, _ := decisions[0].Arg("resolution")
+			s.Equal(tt.resolution, resolution)
+		})
+	}
+}
+
+func (s *ConflictsSuite) TestValueColumn() {
+	tests := []struct {
+		name   string
+		policy string
+		field  string
+		value  interface{}
+		column string
+	}{
+		{"sibling of a decimal", config.TypeConflictSibling, "amount", json.Number("1.5"), "amount_numeric"},
+		{"integer fits", config.TypeConflictSibling, "amount", json.Number("7"), "amount"},
+		{"no sibling of the type", config.TypeConflictSibling, "amount", "abc", "amount"},
+		{"unknown column", config.TypeConflictSibling, "memo", json.Number("1.5"), "memo"},
+		{"widen", config.TypeConflictWiden, "amount", json.Number("1.5"), "amount"},
+		{"quarantine", config.TypeConflictQuarantine, "amount", json.Number("1.5"), "amount"},
+	}
+
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			s.Equal(tt.column, s.indexer(tt.policy).ValueColumn("amounts", tt.field, tt.value))
+		})
+	}
+}
+
+func TestConflictsSuite(t *testing.T) {
+	suite.Run(t, new(ConflictsSuite))
+}
@@ -0,0 +1,160 @@
+package indexer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/iancoleman/strcase"
+	"github.com/lib/pq"
+
+	"juno-contracts-worker/db/model"
+)
+
+const schemaMismatchesTableName = "schema_mismatches"
+
+// messageKinds are the message kinds with a cosmwasm-schema file, query messages are never sent in txs
+var messageKinds = []string{"instantiate", "execute", "migrate"}
+
+func (s *Service) initContractSchemas() error {
+	mismatchFields := map[string]interface{}{
+		"entity":    "TEXT",
+		"parent_id": "TEXT",
+		"code_id":   "TEXT",
+		"errors":    "TEXT[]",
+		"tx_hash":   "TEXT",
+		"tx_height": "NUMERIC",
+	}
+	if err := s.db.CreateTable(schemaMismatchesTableName, mismatchFields); err != nil {
+		return fmt.Errorf("could not create table %s: %w", schemaMismatchesTableName, err)
+	}
+
+	for codeID, dir := range s.cfg.ContractSchemas {
+		schemas, err := readContractSchemas(dir)
+		if err != nil {
+			return fmt.Errorf("could not read schemas of code %s: %w", codeID, err)
+		}
+		s.contractSchemas[codeID] = schemas
+
+		for _, msgTable := range s.cfg.Messages {
+			name := strcase.ToSnake(msgTable[0 : len(msgTable)-1])
+			schema, ok := schemas[messageKind(name)]
+			if !ok {
+				continue
+			}
+
+			if err = s.createSchemaTables(schema, name, codeID); err != nil {
+				return fmt.Errorf("could not create tables of code %s from schema: %w", codeID, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// readContractSchemas reads instantiate_msg.json like files of cosmwasm-schema, or raw/instantiate.json of newer versions
+func readContractSchemas(dir string) (map[string]*JsonSchema, error) {
+	schemas := make(map[string]*JsonSchema)
+
+	for _, kind := range messageKinds {
+		for _, path := range []string{
+			filepath.Join(dir, kind+"_msg.json"),
+			filepath.Join(dir, "raw", kind+".json"),
+		} {
+			data, err := os.ReadFile(path)
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			schema, err := ParseJsonSchema(data)
+			if err != nil {
+				return nil, fmt.Errorf("could not parse %s: %w", path, err)
+			}
+			schemas[kind] = schema
+			break
+		}
+	}
+
+	if len(schemas) == 0 {
+		return nil, fmt.Errorf("no message schemas in %s", dir)
+	}
+
+	return schemas, nil
+}
+
+func messageKind(name string) string {
+	for _, kind := range messageKinds {
+		if strings.Contains(name, kind) {
+			return kind
+		}
+	}
+	return ""
+}
+
+// createSchemaTables creates the tables of all fields the schema allows before the first message arrives
+func (s *Service) createSchemaTables(schema *JsonSchema, parentName, codeID string) error {
+	sample, ok := schema.Sample().(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	name := fmt.Sprintf("%s_%s", parentName, codeID)
+	order, tables := s.generateTablesForEntity(sample, name, true, true)
+	if err := s.renameLegacyTables(order, name, parentName+"s"); err != nil {
+		return err
+	}
+
+	tableExists, err := s.TableExists(name)
+	if err != nil {
+		return fmt.Errorf("could not verify if table %s exists, err: %w", name, err)
+	}
+
+	if err = s.registerSchema(name, observedSchema(tables), &model.MessageMeta{CodeID: codeID}); err != nil {
+		return err
+	}
+
+	addMetaColumns(tables, name)
+	if err = s.createTables(order, tables, name, parentName+"s", tableExists); err != nil {
+		return err
+	}
+
+	return s.saveEnumFields(order)
+}
+
+func (s *Service) contractSchema(codeID, parentName string) *JsonSchema {
+	return s.contractSchemas[codeID][messageKind(parentName)]
+}
+
+// checkSchema flags messages that do not match the schema of their contract, the message is saved anyway
+func (s *Service) checkSchema(msg interface{}, parentID, parentName string, meta *model.MessageMeta) error {
+	if meta == nil {
+		return nil
+	}
+
+	schema := s.contractSchema(meta.CodeID, parentName)
+	if schema == nil {
+		return nil
+	}
+
+	errs := schema.Validate(msg)
+	if len(errs) == 0 {
+		return nil
+	}
+
+	s.log.Warnf("Message %s of code %s does not match schema: %s", parentID, meta.CodeID, strings.Join(errs, "; "))
+
+	name := fmt.Sprintf("%s_%s", parentName, meta.CodeID)
+	id := uuid.NewSHA1(uuid.NameSpaceOID, []byte(fmt.Sprintf("%s/%s/%s", schemaMismatchesTableName, name, parentID)))
+	fields := []string{"id", "entity", "parent_id", "code_id", "errors", "tx_hash", "tx_height"}
+	values := []any{id, name, parentID, meta.CodeID, pq.Array(errs), meta.TxHash, meta.Height}
+	if err := s.db.Insert(schemaMismatchesTableName, fields, values); err != nil {
+		return fmt.Errorf("could not flag message %s: %w", parentID, err)
+	}
+
+	return nil
+}
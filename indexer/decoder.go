@@ -0,0 +1,74 @@
+package indexer
+
+import (
+	"strings"
+	"sync"
+
+	"juno-contracts-worker/db"
+	"juno-contracts-worker/db/model"
+)
+
+// Decoder handles messages of a contract before the generic normalization.
+// Decode returns the message the generic path should save, or nil when the decoder
+// wrote its own tables with d and took the message over. d is the transaction of the
+// message. Numbers in msg are json.Number.
+type Decoder interface {
+	Name() string
+	Decode(d db.ServiceInterface, meta *model.MessageMeta, msg map[string]interface{}) (map[string]interface{}, error)
+}
+
+// Registry finds the decoder of a message, a contract address wins over a code checksum and a checksum over a code ID
+type Registry struct {
+	mu         sync.RWMutex
+	byContract map[string]Decoder
+	byChecksum map[string]Decoder
+	byCodeID   map[string]Decoder
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		byContract: make(map[string]Decoder),
+		byChecksum: make(map[string]Decoder),
+		byCodeID:   make(map[string]Decoder),
+	}
+}
+
+func (r *Registry) RegisterContract(address string, d Decoder) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.byContract[address] = d
+}
+
+func (r *Registry) RegisterChecksum(checksum string, d Decoder) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.byChecksum[strings.ToLower(checksum)] = d
+}
+
+func (r *Registry) RegisterCodeID(codeID string, d Decoder) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.byCodeID[codeID] = d
+}
+
+func (r *Registry) hasChecksums() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.byChecksum) > 0
+}
+
+func (r *Registry) Lookup(contract, checksum, codeID string) Decoder {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if d, ok := r.byContract[contract]; ok && contract != "" {
+		return d
+	}
+	if d, ok := r.byChecksum[strings.ToLower(checksum)]; ok && checksum != "" {
+		return d
+	}
+	if d, ok := r.byCodeID[codeID]; ok && codeID != "" {
+		return d
+	}
+	return nil
+}
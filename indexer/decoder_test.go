@@ -0,0 +1,77 @@
+package indexer_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/suite"
+
+	"juno-contracts-worker/config"
+	"juno-contracts-worker/db"
+	"juno-contracts-worker/db/dbtest"
+	"juno-contracts-worker/db/model"
+	"juno-contracts-worker/indexer"
+)
+
+type namedDecoder string
+
+func (d namedDecoder) Name() string {
+	return string(d)
+}
+
+func (d namedDecoder) Decode(_ db.ServiceInterface, meta *model.MessageMeta, msg map[string]interface{}) (map[string]interface{}, error) {
+	return msg, nil
+}
+
+type Registry struct {
+	suite.Suite
+}
+
+func (r *Registry) TestLookupPrecedence() {
+	registry := indexer.NewRegistry()
+	registry.RegisterCodeID("42", namedDecoder("code"))
+	registry.RegisterChecksum("ABCDEF", namedDecoder("checksum"))
+	registry.RegisterContract("juno1contract", namedDecoder("contract"))
+
+	r.Equal("contract", registry.Lookup("juno1contract", "abcdef", "42").Name())
+
+	r.Equal("checksum", registry.Lookup("juno1other", "abcdef", "42").Name())
+
+	r.Equal("code", registry.Lookup("juno1other", "", "42").Name())
+
+	r.Nil(registry.Lookup("juno1other", "", "43"))
+}
+
+func TestRegistry(t *testing.T) {
+	suite.Run(t, new(Registry))
+}
+
+type RawDecoderSuite struct {
+	suite.Suite
+}
+
+func (s *RawDecoderSuite) TestMessageIsSavedAsJson() {
+	conn, fake, err := dbtest.Open()
+	s.Require().NoError(err)
+	log := logrus.New()
+	log.SetOutput(os.Stderr)
+	i := indexer.New(nil, db.NewWithConn(log, conn), log, &config.Config{RawCodeIDs: []string{"42"}})
+
+	meta := &model.MessageMeta{TxSuccess: true, Height: 100, TxHash: "T"}
+	s.Require().NoError(i.SaveJsonAsEntity("m1", "msg_execute_contract", `{"codeId": "42", "contract": "juno1token", "msg": {"transfer": {"amount": "10"}}}`, meta))
+
+	inserts := fake.Find(`INSERT INTO app."raw_messages"`)
+	s.Require().Len(inserts, 1)
+	msg, _ := inserts[0].Arg("msg")
+	s.JSONEq(`{"transfer": {"amount": "10"}}`, msg.(string))
+	contract, _ := inserts[0].Arg("contract_address")
+	s.Equal("juno1token", contract)
+
+	// no entity tables are generated
+	s.Empty(fake.Find(`CREATE TABLE`))
+}
+
+func TestRawDecoderSuite(t *testing.T) {
+	suite.Run(t, new(RawDecoderSuite))
+}
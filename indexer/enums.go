@@ -0,0 +1,145 @@
+package indexer
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"juno-contracts-worker/db/model"
+)
+
+const enumFieldsTableName = "enum_fields"
+
+// knownVariants are variants of common cosmwasm enums, like Expiration, Duration, Threshold and Denom,
+// fields holding them are enums from the first message
+var knownVariants = map[string]bool{
+	"at_height":           true,
+	"at_time":             true,
+	"never":               true,
+	"absolute_count":      true,
+	"absolute_percentage": true,
+	"threshold_quorum":    true,
+	"native":              true,
+	"cw20":                true,
+}
+
+func (s *Service) initEnumFields() error {
+	enumFields := map[string]interface{}{
+		"table_name": "TEXT",
+		"field":      "TEXT",
+	}
+
+	if err := s.db.CreateTable(enumFieldsTableName, enumFields); err != nil {
+		return fmt.Errorf("could not create table %s: %w", enumFieldsTableName, err)
+	}
+
+	if err := s.db.CreateUniqueIndex([]string{"table_name", "field"}, enumFieldsTableName+"_field_idx", enumFieldsTableName); err != nil {
+		return fmt.Errorf("could not create index on table %s: %w", enumFieldsTableName, err)
+	}
+
+	var tableName, field string
+	rows, err := s.db.Select(enumFieldsTableName, []string{"table_name", "field"}, &model.QParameters{})
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for rows.Next() {
+		if err = rows.Scan(&tableName, &field); err != nil {
+			return err
+		}
+		s.cache.enums[tableName+"/"+field] = true
+	}
+
+	return nil
+}
+
+// variantOf returns the variant and payload of an enum shaped value, an object with a single key
+func variantOf(v interface{}) (string, interface{}, bool) {
+	m, ok := v.(map[string]interface{})
+	if !ok || len(m) != 1 {
+		return "", nil, false
+	}
+	for variant, payload := range m {
+		return variant, payload, true
+	}
+	return "", nil, false
+}
+
+// observeVariant marks the field as an enum when it carries a known variant. An object with a single
+// key is not enough, a struct with one field set looks the same, and rows saved before could not be moved.
+// New enum fields are saved with the entities of the message by saveEnumFields.
+func (s *Service) observeVariant(name, field string, v interface{}) {
+	variant, _, ok := variantOf(v)
+	if !ok || !knownVariants[variant] {
+		return
+	}
+
+	key := name + "/" + field
+	s.mu.Lock()
+	if s.cachedFlag(enumsOf, key) {
+		s.mu.Unlock()
+		return
+	}
+	w := s.writable()
+	w.enums[key] = true
+	w.newEnums[name] = append(w.newEnums[name], field)
+	s.mu.Unlock()
+
+	s.log.Infof("Field %s of %s is an enum, variants are saved to %s_variant", field, name, field)
+}
+
+// saveEnumFields records the enum fields found in the tables of a message
+func (s *Service) saveEnumFields(order []string) error {
+	s.mu.Lock()
+	newEnums := make(map[string][]string)
+	for _, tableName := range order {
+		if fields, ok := s.writable().newEnums[tableName]; ok {
+			newEnums[tableName] = fields
+			delete(s.writable().newEnums, tableName)
+		}
+	}
+	s.mu.Unlock()
+
+	for tableName, fields := range newEnums {
+		for _, field := range fields {
+			id := uuid.NewSHA1(uuid.NameSpaceOID, []byte(fmt.Sprintf("%s/%s/%s", enumFieldsTableName, tableName, field)))
+			if err := s.db.Insert(enumFieldsTableName, []string{"id", "table_name", "field"}, []any{id, tableName, field}); err != nil {
+				return fmt.Errorf("could not record enum field %s of %s: %w", field, tableName, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *Service) isEnum(name, field string, v interface{}) bool {
+	if _, _, ok := variantOf(v); !ok {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cachedFlag(enumsOf, name+"/"+field)
+}
+
+// enumValues returns the variant and the payload for its JSONB column, unit variants have no payload
+func enumValues(v interface{}) (string, any, error) {
+	variant, payload, _ := variantOf(v)
+	if m, ok := payload.(map[string]interface{}); payload == nil || ok && len(m) == 0 {
+		return variant, nil, nil
+	}
+
+	bytes, err := json.Marshal(payload)
+	if err != nil {
+		return "", nil, err
+	}
+	return variant, string(bytes), nil
+}
+
+func variantColumn(field string) string {
+	return field + "_variant"
+}
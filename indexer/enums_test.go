@@ -0,0 +1,70 @@
+package indexer_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"juno-contracts-worker/indexer"
+)
+
+type EnumsSuite struct {
+	suite.Suite
+}
+
+func (s *EnumsSuite) TestVariantOf() {
+	tests := []struct {
+		name    string
+		value   interface{}
+		variant string
+		payload interface{}
+		ok      bool
+	}{
+		{"unit variant", map[string]interface{}{"never": map[string]interface{}{}}, "never", map[string]interface{}{}, true},
+		{"scalar payload", map[string]interface{}{"at_height": float64(5)}, "at_height", float64(5), true},
+		{"null payload", map[string]interface{}{"never": nil}, "never", nil, true},
+		{"two keys", map[string]interface{}{"a": 1, "b": 2}, "", nil, false},
+		{"empty object", map[string]interface{}{}, "", nil, false},
+		{"string", "never", "", nil, false},
+		{"array", []interface{}{map[string]interface{}{"never": nil}}, "", nil, false},
+		{"nil", nil, "", nil, false},
+	}
+
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			variant, payload, ok := indexer.VariantOf(tt.value)
+			s.Equal(tt.ok, ok)
+			s.Equal(tt.variant, variant)
+			s.Equal(tt.payload, payload)
+		})
+	}
+}
+
+func (s *EnumsSuite) TestEnumValues() {
+	tests := []struct {
+		name    string
+		value   interface{}
+		variant string
+		payload any
+	}{
+		{"unit variant", map[string]interface{}{"never": map[string]interface{}{}}, "never", nil},
+		{"null payload", map[string]interface{}{"never": nil}, "never", nil},
+		{"scalar payload", map[string]interface{}{"at_height": float64(5)}, "at_height", "5"},
+		{"string payload", map[string]interface{}{"at_time": "1656669600000000000"}, "at_time", `"1656669600000000000"`},
+		{"object payload", map[string]interface{}{"cw20": map[string]interface{}{"address": "juno1"}}, "cw20", `{"address":"juno1"}`},
+		{"not an enum", "never", "", nil},
+	}
+
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			variant, payload, err := indexer.EnumValues(tt.value)
+			s.Require().NoError(err)
+			s.Equal(tt.variant, variant)
+			s.Equal(tt.payload, payload)
+		})
+	}
+}
+
+func TestEnumsSuite(t *testing.T) {
+	suite.Run(t, new(EnumsSuite))
+}
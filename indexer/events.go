@@ -0,0 +1,221 @@
+package indexer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/google/uuid"
+
+	"juno-contracts-worker/db/model"
+	"juno-contracts-worker/utils"
+)
+
+const (
+	wasmEventsTableName     = "wasm_events"
+	wasmAttributesTableName = "wasm_event_attributes"
+)
+
+func (s *Service) initEventTables() error {
+	eventFields := map[string]interface{}{
+		"message_table":    "TEXT",
+		"message_id":       "TEXT",
+		"height":           "NUMERIC",
+		"tx_hash":          "TEXT",
+		"msg_index":        "INT",
+		"event_index":      "INT",
+		"type":             "TEXT",
+		"contract_address": "TEXT",
+	}
+	attributeFields := map[string]interface{}{
+		"event_id":   fmt.Sprintf("UUID REFERENCES app.%s", wasmEventsTableName),
+		"attr_index": "INT",
+		"key":        "TEXT",
+		"value":      "TEXT",
+	}
+
+	if err := s.db.CreateTable(wasmEventsTableName, eventFields); err != nil {
+		return fmt.Errorf("could not create table %s: %w", wasmEventsTableName, err)
+	}
+
+	if err := s.indexTable(wasmEventsTableName, eventFields); err != nil {
+		return err
+	}
+
+	if err := s.db.CreateTable(wasmAttributesTableName, attributeFields); err != nil {
+		return fmt.Errorf("could not create table %s: %w", wasmAttributesTableName, err)
+	}
+
+	if err := s.indexTable(wasmAttributesTableName, attributeFields); err != nil {
+		return err
+	}
+
+	for codeID, attributes := range s.cfg.EventProjections {
+		fields := map[string]interface{}{
+			"event_id":         fmt.Sprintf("UUID REFERENCES app.%s", wasmEventsTableName),
+			"height":           "NUMERIC",
+			"contract_address": "TEXT",
+		}
+		for _, a := range attributes {
+			fields[projectionColumn(a.Key)] = a.ColumnType()
+		}
+
+		tableName := projectionTableName(codeID)
+		if err := s.db.CreateTable(tableName, fields); err != nil {
+			return fmt.Errorf("could not create table %s: %w", tableName, err)
+		}
+
+		if err := s.indexTable(tableName, fields); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Service) FetchTxResult(txHash string) (*model.TxResult, error) {
+	if s.cfg.EventsTable == "" {
+		return s.client.GetTx(txHash)
+	}
+
+	var msgIndex int32
+	var eventType, attributes string
+	fields := []string{"msg_index", "type", "attributes"}
+	qFields := map[string]any{
+		"tx_hash": txHash,
+	}
+	qParams := &model.QParameters{Fields: qFields}
+
+	rows, err := s.db.Select(s.cfg.EventsTable, fields, qParams)
+	if err != nil {
+		return nil, fmt.Errorf("could not query events of tx %s: %w", txHash, err)
+	}
+	defer rows.Close()
+
+	result := &model.TxResult{Hash: txHash}
+	for rows.Next() {
+		if err = rows.Scan(&msgIndex, &eventType, &attributes); err != nil {
+			return nil, err
+		}
+
+		event := model.Event{MsgIndex: msgIndex, Type: eventType}
+		if err = json.Unmarshal([]byte(attributes), &event.Attributes); err != nil {
+			return nil, fmt.Errorf("could not unmarshal attributes of tx %s: %w", txHash, err)
+		}
+		result.Events = append(result.Events, event)
+	}
+
+	return result, nil
+}
+
+func (s *Service) FetchTx(txHash string) (*model.TxResult, error) {
+	return s.client.GetTx(txHash)
+}
+
+func (s *Service) SaveWasmEvents(messageTable, messageID string, height int32, txHash string, msgIndex int32, tx *model.TxResult) error {
+	eventFields := []string{"id", "message_table", "message_id", "height", "tx_hash", "msg_index", "event_index", "type", "contract_address"}
+	attributeFields := []string{"id", "event_id", "attr_index", "key", "value"}
+
+	for eventIndex, event := range tx.WasmEvents(msgIndex) {
+		// ids are derived from the event position so reprocessing a message does not duplicate rows
+		eventID := uuid.NewSHA1(uuid.NameSpaceOID, []byte(fmt.Sprintf("%s/%d/%d", txHash, msgIndex, eventIndex)))
+		contract := event.Value(model.ContractAddressKey)
+
+		values := []any{eventID, messageTable, messageID, height, txHash, msgIndex, eventIndex, event.Type, contract}
+		if err := s.db.Insert(wasmEventsTableName, eventFields, values); err != nil {
+			return fmt.Errorf("could not save event of tx %s: %w", txHash, err)
+		}
+
+		for i, a := range event.Attributes {
+			attributeID := uuid.NewSHA1(eventID, []byte(strconv.Itoa(i)))
+			if err := s.db.Insert(wasmAttributesTableName, attributeFields, []any{attributeID, eventID, i, a.Key, a.Value}); err != nil {
+				return fmt.Errorf("could not save event attribute of tx %s: %w", txHash, err)
+			}
+		}
+
+		if err := s.projectEvent(eventID, height, contract, event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Service) projectEvent(eventID uuid.UUID, height int32, contract string, event model.Event) error {
+	if len(s.cfg.EventProjections) == 0 || contract == "" {
+		return nil
+	}
+
+	codeID, err := s.contractCodeID(contract)
+	if err != nil {
+		return err
+	}
+
+	attributes, ok := s.cfg.EventProjections[codeID]
+	if !ok {
+		return nil
+	}
+
+	fields := []string{"id", "event_id", "height", "contract_address"}
+	values := []any{uuid.NewSHA1(eventID, []byte(codeID)), eventID, height, contract}
+	for _, projected := range attributes {
+		for _, a := range event.Attributes {
+			if a.Key != projected.Key {
+				continue
+			}
+			// a value that does not fit the column type is left NULL, the raw value stays in wasm_event_attributes
+			value, ok := attributeValue(a.Value, projected.ColumnType())
+			if !ok {
+				s.log.Debugf("Skip attribute %s of event %s, %q is not %s", a.Key, eventID, a.Value, projected.ColumnType())
+				break
+			}
+			fields = append(fields, projectionColumn(a.Key))
+			values = append(values, value)
+			break
+		}
+	}
+
+	return s.db.Insert(projectionTableName(codeID), fields, values)
+}
+
+func (s *Service) contractCodeID(address string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if codeID, ok := s.codeIDs[address]; ok {
+		return codeID, nil
+	}
+
+	code, err := s.client.GetContractInfo(address)
+	if err != nil {
+		return "", err
+	}
+
+	codeID := strconv.Itoa(int(code))
+	s.codeIDs[address] = codeID
+	return codeID, nil
+}
+
+// attributeValue converts an attribute to the value of its projected column
+func attributeValue(value, columnType string) (any, bool) {
+	switch columnType {
+	case "BIGINT":
+		v, err := strconv.ParseInt(value, 10, 64)
+		return v, err == nil
+	case "NUMERIC":
+		return value, utils.IsNumericString(value)
+	case "BOOLEAN":
+		v, err := strconv.ParseBool(value)
+		return v, err == nil
+	default:
+		return value, true
+	}
+}
+
+func projectionTableName(codeID string) string {
+	return fmt.Sprintf("%s_code%s", wasmEventsTableName, codeID)
+}
+
+func projectionColumn(key string) string {
+	return utils.Identifier("attr_" + utils.ColumnName(key))
+}
@@ -0,0 +1,86 @@
+package indexer_test
+
+import (
+	"database/sql/driver"
+	"os"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/suite"
+
+	"juno-contracts-worker/config"
+	"juno-contracts-worker/db"
+	"juno-contracts-worker/db/dbtest"
+	"juno-contracts-worker/db/model"
+	"juno-contracts-worker/indexer"
+)
+
+type EventsSuite struct {
+	suite.Suite
+	fake    *dbtest.DB
+	indexer *indexer.Service
+}
+
+func (s *EventsSuite) SetupTest() {
+	conn, fake, err := dbtest.Open()
+	s.Require().NoError(err)
+	s.fake = fake
+
+	log := logrus.New()
+	log.SetOutput(os.Stderr)
+	cfg := &config.Config{
+		EventProjections: map[string][]config.EventAttribute{
+			"42": {{Key: "action"}, {Key: "amount", Type: "NUMERIC"}, {Key: "count", Type: "bigint"}},
+		},
+	}
+	s.indexer = indexer.New(nil, db.NewWithConn(log, conn), log, cfg)
+	s.indexer.SetContractCodeID("juno1token", "42")
+}
+
+func (s *EventsSuite) TestProjectionColumnsAreTyped() {
+	s.Require().NoError(s.indexer.InitTables())
+
+	create := s.fake.Find(`CREATE TABLE IF NOT EXISTS app."wasm_events_code42"`)
+	s.Require().Len(create, 1)
+	s.Contains(create[0].Statement, `"attr_action" TEXT`)
+	s.Contains(create[0].Statement, `"attr_amount" NUMERIC`)
+	s.Contains(create[0].Statement, `"attr_count" BIGINT`)
+}
+
+func (s *EventsSuite) TestProjectedValuesAreConverted() {
+	tx := &model.TxResult{Events: []model.Event{{
+		Type: "wasm",
+		Attributes: []model.Attribute{
+			{Key: "_contract_address", Value: "juno1token"},
+			{Key: "action", Value: "transfer"},
+			{Key: "amount", Value: "100.5"},
+			{Key: "count", Value: "many"},
+		},
+	}}}
+	s.Require().NoError(s.indexer.SaveWasmEvents("msg_execute_contracts", "m1", 10, "T", 0, tx))
+
+	inserts := s.fake.Find(`INSERT INTO app."wasm_events_code42"`)
+	s.Require().Len(inserts, 1)
+	// a count that is not a number is left NULL
+	s.Contains(inserts[0].Statement, `"attr_action", "attr_amount")`)
+	s.Equal([]driver.Value{"transfer", "100.5"}, inserts[0].Args[4:])
+}
+
+func (s *EventsSuite) TestBigintValuesAreParsed() {
+	tx := &model.TxResult{Events: []model.Event{{
+		Type: "wasm",
+		Attributes: []model.Attribute{
+			{Key: "_contract_address", Value: "juno1token"},
+			{Key: "count", Value: "7"},
+		},
+	}}}
+	s.Require().NoError(s.indexer.SaveWasmEvents("msg_execute_contracts", "m1", 10, "T", 0, tx))
+
+	inserts := s.fake.Find(`INSERT INTO app."wasm_events_code42"`)
+	s.Require().Len(inserts, 1)
+	s.Equal(int64(7), inserts[0].Args[4])
+}
+
+func TestEventsSuite(t *testing.T) {
+	suite.Run(t, new(EventsSuite))
+}
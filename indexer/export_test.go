@@ -0,0 +1,65 @@
+package indexer
+
+import "juno-contracts-worker/db/model"
+
+// helpers exposed to the tests of package indexer_test
+
+// SetContractCodeID caches the code ID of a contract, so tests do not query the node
+func (s *Service) SetContractCodeID(address, codeID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.codeIDs[address] = codeID
+}
+
+// ResolveConflict exposes resolveConflicts for one conflict of an entity message
+func (s *Service) ResolveConflict(table, column, liveType, inferredType string, msg map[string]interface{}, meta *model.MessageMeta) (bool, error) {
+	c := typeConflict{table: table, column: column, liveType: liveType, inferredType: inferredType}
+	return s.resolveConflicts([]typeConflict{c}, msg, "p1", "entity", meta)
+}
+
+// ValueColumn exposes valueColumn to the tests of package indexer_test
+func (s *Service) ValueColumn(tableName, field string, v interface{}) string {
+	return s.valueColumn(tableName, field, v)
+}
+
+// VariantOf and EnumValues expose the enum helpers to the tests of package indexer_test
+var (
+	VariantOf  = variantOf
+	EnumValues = enumValues
+)
+
+// DecodeBinaryJson exposes decodeBinaryJson to the tests of package indexer_test
+var DecodeBinaryJson = decodeBinaryJson
+
+// AddressRef is an address found by FindAddresses
+type AddressRef struct {
+	Address string
+	Prefix  string
+	Table   string
+	Column  string
+}
+
+// FindAddresses exposes findAddresses to the tests of package indexer_test
+func (s *Service) FindAddresses(msg map[string]interface{}, name string) []AddressRef {
+	var refs []AddressRef
+	for _, ref := range s.findAddresses(msg, name) {
+		refs = append(refs, AddressRef{Address: ref.address, Prefix: ref.prefix, Table: ref.table, Column: ref.column})
+	}
+	return refs
+}
+
+// Temporal is a typed column returned by TemporalColumns
+type Temporal struct {
+	Column string
+	Type   string
+	Value  any
+}
+
+// TemporalColumns exposes temporalColumns to the tests of package indexer_test
+func TemporalColumns(column string, v interface{}) []Temporal {
+	var columns []Temporal
+	for _, t := range temporalColumns(column, v) {
+		columns = append(columns, Temporal{Column: t.column, Type: t.columnType, Value: t.value})
+	}
+	return columns
+}
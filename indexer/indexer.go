@@ -4,21 +4,24 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"os"
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/google/uuid"
 	"github.com/iancoleman/strcase"
 	"github.com/sirupsen/logrus"
 
 	"juno-contracts-worker/client"
+	"juno-contracts-worker/config"
 	"juno-contracts-worker/db"
 	"juno-contracts-worker/db/model"
 	"juno-contracts-worker/utils"
 )
 
+var numberType = reflect.TypeOf(json.Number(""))
+
 type manyToMany struct {
 	tableName string
 	field     string
@@ -29,10 +32,100 @@ type Service struct {
 	client *client.Client
 	db     db.ServiceInterface
 	log    *logrus.Logger
+	cfg    *config.Config
+
+	decoders *Registry
+
+	*state
+	// delta keeps the cache changes of a transaction, it is nil outside of one
+	delta *caches
+}
+
+// state is shared by the service and its copies bound to a transaction
+type state struct {
+	mu        sync.Mutex
+	codeIDs   map[string]string
+	checksums map[string]string
+	declared  map[string][][]string
+	cache     *caches
+
+	schemaMu sync.Mutex
+
+	contractSchemas map[string]map[string]*JsonSchema
 }
 
-func New(c *client.Client, d db.ServiceInterface, l *logrus.Logger) *Service {
-	return &Service{client: c, db: d, log: l}
+func New(c *client.Client, d db.ServiceInterface, l *logrus.Logger, cfg *config.Config) *Service {
+	s := &Service{
+		client:   c,
+		db:       d,
+		log:      l,
+		cfg:      cfg,
+		decoders: NewRegistry(),
+		state: &state{
+			codeIDs:   make(map[string]string),
+			checksums: make(map[string]string),
+			cache:     newCaches(),
+
+			contractSchemas: make(map[string]map[string]*JsonSchema),
+		},
+	}
+
+	for _, codeID := range cfg.RawCodeIDs {
+		s.decoders.RegisterCodeID(codeID, RawDecoder{})
+	}
+
+	return s
+}
+
+// WithDB returns a copy of the service writing to d, like a transaction. Its cache changes
+// are kept apart until MergeCaches.
+func (s *Service) WithDB(d db.ServiceInterface) *Service {
+	c := *s
+	c.db = d
+	c.delta = newCaches()
+	return &c
+}
+
+func (s *Service) Decoders() *Registry {
+	return s.decoders
+}
+
+func (s *Service) InitTables() error {
+	if err := s.initNameMap(); err != nil {
+		return err
+	}
+
+	if err := s.initBlocksTable(); err != nil {
+		return err
+	}
+
+	s.declared = s.declaredIndexes()
+
+	if err := s.initAddressRefs(); err != nil {
+		return err
+	}
+
+	if err := s.initEnumFields(); err != nil {
+		return err
+	}
+
+	if err := s.initSchemaRegistry(); err != nil {
+		return err
+	}
+
+	if err := s.initConflictTables(); err != nil {
+		return err
+	}
+
+	if err := s.initEventTables(); err != nil {
+		return err
+	}
+
+	if err := s.initRawTable(); err != nil {
+		return err
+	}
+
+	return s.initContractSchemas()
 }
 
 func (s *Service) AddColumn(idxName, parentTableName, tableName string) error {
@@ -42,7 +135,12 @@ func (s *Service) AddColumn(idxName, parentTableName, tableName string) error {
 
 func (s *Service) CreateTable(tableName string, fields map[string]interface{}) error {
 	s.log.Debugf("Create table %s: %v", tableName, fields)
-	return s.db.CreateTable(tableName, fields)
+	if err := s.db.CreateTable(tableName, fields); err != nil {
+		return err
+	}
+
+	s.rememberColumns(tableName, fields)
+	return s.recordName(tableName)
 }
 
 func (s *Service) CreateColumns(tableName string, fields map[string]interface{}) error {
@@ -53,20 +151,30 @@ func (s *Service) CreateColumns(tableName string, fields map[string]interface{})
 
 	for k, v := range fields {
 		val := v.(string)
-		if strings.Contains(k, "UNIQUE") {
+		switch {
+		case strings.Contains(k, "UNIQUE"):
 			continue
 
-		} else if strings.Contains(k, "REFERENCES") {
+		case strings.Contains(k, "REFERENCES"):
 			k = utils.GetFieldName(k)
 			if err := s.db.AddColumn(k, tableName, k); err != nil {
 				return err
 			}
 
-		} else if err := s.db.CreateColumn(tableName, k, val); err != nil {
-			return err
+		case strings.Contains(val, "REFERENCES"):
+			// columns of nested entities are named like the referenced table
+			if err := s.db.CreateColumn(tableName, utils.UniqueShortName(k), val); err != nil {
+				return err
+			}
+
+		default:
+			if err := s.db.CreateColumn(tableName, k, val); err != nil {
+				return err
+			}
 		}
 	}
 
+	s.rememberColumns(tableName, fields)
 	return nil
 }
 
@@ -81,6 +189,10 @@ func (s *Service) TableExists(tableName string) (bool, error) {
 }
 
 func (s *Service) SaveJson(name string, json map[string]interface{}) (string, error) {
+	return s.saveJson(name, json, nil)
+}
+
+func (s *Service) saveJson(name string, json map[string]interface{}, meta *model.MessageMeta) (string, error) {
 	s.log.Debugf("Save entity %s", name)
 
 	uuid, err := uuid.NewRandom()
@@ -96,6 +208,12 @@ func (s *Service) SaveJson(name string, json map[string]interface{}) (string, er
 		return "", err
 	}
 
+	if meta != nil {
+		metaFields, metaValues := meta.Values()
+		fields = append(fields, metaFields...)
+		vArray = append(vArray, metaValues...)
+	}
+
 	if err := s.db.Insert(name, fields, vArray); err != nil {
 		return "", err
 	}
@@ -109,15 +227,36 @@ func (s *Service) SaveJson(name string, json map[string]interface{}) (string, er
 	return entityID, nil
 }
 
-func (s *Service) parseJsonIntoQuery(json map[string]interface{}, name string) (valuesArr []any, fields []string, m []manyToMany, err error) {
+func (s *Service) parseJsonIntoQuery(jsonMap map[string]interface{}, name string) (valuesArr []any, fields []string, m []manyToMany, err error) {
 	name = utils.DeleteS(name)
-	for k, v := range json {
-		k = utils.DeleteS(k)
-		field := k
+	columns := s.columnNames(name, jsonMap)
+	for k, v := range jsonMap {
+		// null values are left out of the insert so the column stays NULL
+		if v == nil {
+			continue
+		}
+
+		field := columns[k]
+		for _, t := range temporalColumns(field, v) {
+			if t.value != nil {
+				valuesArr = append(valuesArr, t.value)
+				fields = append(fields, t.column)
+			}
+		}
 
 		switch reflect.TypeOf(v) {
 		case reflect.TypeOf(map[string]interface{}{}):
-			field = strcase.ToSnake(fmt.Sprintf("%s %s", name, k))
+			if s.isEnum(name, field, v) {
+				variant, payload, err := enumValues(v)
+				if err != nil {
+					return nil, nil, nil, fmt.Errorf("could not marshal %s, err: %w", field, err)
+				}
+				valuesArr = append(valuesArr, variant, payload)
+				fields = append(fields, variantColumn(field), field)
+				continue
+			}
+
+			field = nestedName(name, k)
 			entityID, err := s.SaveJson(field, v.(map[string]interface{}))
 			if err != nil {
 				return nil, nil, nil, fmt.Errorf("could not save %s, err: %w", field, err)
@@ -127,13 +266,26 @@ func (s *Service) parseJsonIntoQuery(json map[string]interface{}, name string) (
 
 		case reflect.TypeOf([]interface{}{}):
 			val := v.([]interface{})
+			field = s.valueColumn(name, field, v)
+
+			switch utils.ArrayType(val) {
+			case utils.ArrayEmpty:
+				continue
 
-			if isArray, _ := utils.IsArray(val); isArray {
+			case utils.ArrayJson:
+				bytes, err := json.Marshal(val)
+				if err != nil {
+					return nil, nil, nil, fmt.Errorf("could not marshal %s, err: %w", field, err)
+				}
+				valuesArr = append(valuesArr, string(bytes))
+				fields = append(fields, field)
+
+			case utils.ArrayText, utils.ArrayNumeric, utils.ArrayBoolean:
 				valuesArr = append(valuesArr, mapArray(val))
 				fields = append(fields, field)
 
-			} else {
-				field = strcase.ToSnake(fmt.Sprintf("%s %s", name, k))
+			case utils.ArrayObjects:
+				field = nestedName(name, k)
 
 				ids, err := s.saveStructArray(val, field)
 				if err != nil {
@@ -147,12 +299,12 @@ func (s *Service) parseJsonIntoQuery(json map[string]interface{}, name string) (
 				})
 			}
 
-		case reflect.TypeOf(""), reflect.TypeOf(float64(0)), reflect.TypeOf(false):
+		case reflect.TypeOf(""), reflect.TypeOf(float64(0)), reflect.TypeOf(false), numberType:
 			valuesArr = append(valuesArr, v)
-			fields = append(fields, field)
+			fields = append(fields, s.valueColumn(name, field, v))
 
 		default:
-			fmt.Println("unknown type ", reflect.TypeOf(v))
+			s.log.Debugf("Skip field %s of unknown type %s", k, reflect.TypeOf(v))
 		}
 	}
 
@@ -163,14 +315,7 @@ func mapArray(m []interface{}) string {
 	l := len(m)
 	array := make([]string, l)
 	for i := 0; i < l; i++ {
-		value := m[i]
-		kind := reflect.ValueOf(value).Kind()
-		switch kind {
-		case reflect.Map:
-			array[i] = mapToString(value.(map[string]interface{}))
-		default:
-			array[i] = mapValueToString(value)
-		}
+		array[i] = mapValueToString(m[i])
 	}
 	return fmt.Sprintf("{%s}", strings.Join(array, ","))
 }
@@ -186,23 +331,54 @@ func mapToString(m map[string]interface{}) (s string) {
 }
 
 func mapValueToString(v interface{}) string {
-	kind := reflect.TypeOf(v).Kind()
-	switch kind {
-	case reflect.String:
-		return v.(string)
-	case reflect.Bool:
-		boolean, _ := v.(bool)
-		return strconv.FormatBool(boolean)
+	switch value := v.(type) {
+	case nil:
+		return "NULL"
+	case map[string]interface{}:
+		return mapToString(value)
 	default:
-		fmt.Println("uknown value kind: ", kind)
-		os.Exit(666)
-		return ""
+		element := strings.ReplaceAll(fmt.Sprint(value), `\`, `\\`)
+		return fmt.Sprintf(`"%s"`, strings.ReplaceAll(element, `"`, `\"`))
 	}
 }
 
+// unionObject merges elements of an object array so every field of any element gets a column
+func unionObject(arr []interface{}) map[string]interface{} {
+	union := make(map[string]interface{})
+	for _, v := range arr {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		for k, field := range obj {
+			existing, seen := union[k]
+			existingMap, existingIsMap := existing.(map[string]interface{})
+			fieldMap, fieldIsMap := field.(map[string]interface{})
+			existingArr, existingIsArr := existing.([]interface{})
+			fieldArr, fieldIsArr := field.([]interface{})
+
+			switch {
+			case !seen || existing == nil:
+				union[k] = field
+			case existingIsMap && fieldIsMap:
+				union[k] = unionObject([]interface{}{existingMap, fieldMap})
+			case existingIsArr && fieldIsArr:
+				union[k] = append(append([]interface{}{}, existingArr...), fieldArr...)
+			}
+		}
+	}
+	return union
+}
+
 func (s *Service) saveStructArray(arr []interface{}, fieldName string) (ids []string, err error) {
 	for i := 0; i < len(arr); i++ {
-		entityID, err := s.SaveJson(fieldName, arr[i].(map[string]interface{}))
+		element, ok := arr[i].(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		entityID, err := s.SaveJson(fieldName, element)
 		if err != nil {
 			return nil, fmt.Errorf("could not save %s, err: %w", fieldName, err)
 		}
@@ -238,11 +414,13 @@ func (s *Service) LinkTable(id, linkID, idxName, tableName string) error {
 	return s.db.LinkTable(id, linkID, idxName, tableName)
 }
 
-func (s *Service) SaveJsonAsEntity(parentID, name, msg string) error {
+func (s *Service) SaveJsonAsEntity(parentID, name, msg string, meta *model.MessageMeta) error {
 	var jsonMap map[string]interface{}
 
-	err := json.Unmarshal([]byte(msg), &jsonMap)
-	if err != nil {
+	// numbers are kept as json.Number so big values are saved with full precision
+	decoder := json.NewDecoder(strings.NewReader(msg))
+	decoder.UseNumber()
+	if err := decoder.Decode(&jsonMap); err != nil {
 		return fmt.Errorf("could not unmarshal msg: %w", err)
 	}
 
@@ -257,8 +435,33 @@ func (s *Service) SaveJsonAsEntity(parentID, name, msg string) error {
 	}
 	entityName := fmt.Sprintf("%s_%s", parentName, codeID)
 
+	if meta != nil {
+		if sender, ok := jsonMap["sender"].(string); ok {
+			meta.Sender = sender
+		}
+		if contract, ok := jsonMap["contract"].(string); ok {
+			meta.ContractAddress = contract
+		}
+		meta.CodeID = codeID
+		meta.RawMsg = msg
+	}
+
+	if err := s.checkSchema(jsonMap["msg"], parentID, parentName, meta); err != nil {
+		return err
+	}
+
 	if msg := jsonMap["msg"]; msg != nil {
-		if err := s.processMsg(msg.(map[string]interface{}), parentID, entityName, parentName); err != nil {
+		decoded, err := s.decode(meta, codeID, msg.(map[string]interface{}))
+		if err != nil {
+			return fmt.Errorf("could not decode message: %w", err)
+		}
+		if decoded == nil {
+			return nil
+		}
+
+		s.decodeBinaries(decoded, 0)
+
+		if err := s.processMsg(decoded, parentID, entityName, parentName, meta); err != nil {
 			return fmt.Errorf("could not process message: %w", err)
 		}
 	}
@@ -266,36 +469,97 @@ func (s *Service) SaveJsonAsEntity(parentID, name, msg string) error {
 	return nil
 }
 
-func (s *Service) processMsg(msg map[string]interface{}, parentID, name, parentName string) error {
+func (s *Service) decode(meta *model.MessageMeta, codeID string, msg map[string]interface{}) (map[string]interface{}, error) {
+	var contract, checksum string
+	if meta != nil {
+		contract = meta.ContractAddress
+	}
+
+	if s.decoders.hasChecksums() {
+		var err error
+		if checksum, err = s.codeChecksum(codeID); err != nil {
+			return nil, err
+		}
+	}
+
+	decoder := s.decoders.Lookup(contract, checksum, codeID)
+	if decoder == nil {
+		return msg, nil
+	}
+
+	s.log.Debugf("Decode message of code id %s with %s decoder", codeID, decoder.Name())
+	return decoder.Decode(s.db, meta, msg)
+}
+
+func (s *Service) codeChecksum(codeID string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if checksum, ok := s.checksums[codeID]; ok {
+		return checksum, nil
+	}
+
+	code, err := strconv.ParseUint(codeID, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid code id %s: %w", codeID, err)
+	}
+
+	checksum, err := s.client.GetCodeChecksum(code)
+	if err != nil {
+		return "", err
+	}
+
+	s.checksums[codeID] = checksum
+	return checksum, nil
+}
+
+func (s *Service) processMsg(msg map[string]interface{}, parentID, name, parentName string, meta *model.MessageMeta) error {
 	parentName += "s"
+	order, tables := s.generateTablesForEntity(msg, name, s.numericStrings(meta), true)
+	if err := s.renameLegacyTables(order, name, parentName); err != nil {
+		return err
+	}
+
 	tableExists, err := s.TableExists(name)
 	if err != nil {
 		return fmt.Errorf("could not verify if table %s exists, err: %w", name, err)
 	}
 
-	order, tables := s.generateTablesForEntity(msg, name)
+	// the schema is the shape of the message, meta columns are left out
+	observed := observedSchema(tables)
+	if meta != nil {
+		addMetaColumns(tables, name)
+	}
 
-	if !tableExists {
-		s.log.Info("table not exists")
-		for _, tableName := range order {
-			if err := s.CreateTable(tableName, tables[tableName].(map[string]interface{})); err != nil {
-				return fmt.Errorf("could not create table %s, err: %w", tableName, err)
-			}
+	if tableExists {
+		conflicts, err := s.typeConflicts(order, tables)
+		if err != nil {
+			return err
 		}
 
-		if err := s.AddColumn(name, parentName, name); err != nil {
-			return fmt.Errorf("could not create index %s with %s, err: %w", name, parentName, err)
+		quarantined, err := s.resolveConflicts(conflicts, msg, parentID, name, meta)
+		if err != nil {
+			return fmt.Errorf("could not resolve type conflicts of %s, err: %w", name, err)
 		}
-
-	} else {
-		for _, tableName := range order {
-			if err := s.CreateColumns(tableName, tables[tableName].(map[string]interface{})); err != nil {
-				return fmt.Errorf("could not create table columns  %s, err: %w", tableName, err)
-			}
+		if quarantined {
+			return nil
 		}
 	}
 
-	entityID, err := s.SaveJson(name, msg)
+	// quarantined messages return above, their shape is not part of the entity schema
+	if err := s.registerSchema(name, observed, meta); err != nil {
+		return err
+	}
+
+	if err := s.createTables(order, tables, name, parentName, tableExists); err != nil {
+		return err
+	}
+
+	if err := s.saveEnumFields(order); err != nil {
+		return err
+	}
+
+	entityID, err := s.saveJson(name, msg, meta)
 	if err != nil {
 		return fmt.Errorf("could not save json message, err: %w", err)
 	}
@@ -304,26 +568,111 @@ func (s *Service) processMsg(msg map[string]interface{}, parentID, name, parentN
 		return fmt.Errorf("could not link table %s with %s, err: %w", name, parentName, err)
 	}
 
+	if err := s.saveAddressRefs(msg, name, entityID, meta); err != nil {
+		return fmt.Errorf("could not save addresses of %s, err: %w", name, err)
+	}
+
 	return nil
 }
 
-func (s *Service) generateTablesForEntity(msg map[string]interface{}, name string) ([]string, map[string]interface{}) {
+func addMetaColumns(tables map[string]interface{}, name string) {
+	rootEntity := tables[utils.DeleteS(name)].(map[string]interface{})
+	for k, v := range (&model.MessageMeta{}).Columns() {
+		rootEntity[k] = v
+	}
+}
+
+// createTables creates missing tables and columns, a new root table is linked with its parent
+func (s *Service) createTables(order []string, tables map[string]interface{}, name, parentName string, tableExists bool) error {
+	for _, tableName := range order {
+		// nested tables of optional fields appear with the first message that sets them
+		nestedExists, err := s.TableExists(tableName)
+		if err != nil {
+			return fmt.Errorf("could not verify if table %s exists, err: %w", tableName, err)
+		}
+
+		fields := tables[tableName].(map[string]interface{})
+		if !nestedExists {
+			if err := s.CreateTable(tableName, fields); err != nil {
+				return fmt.Errorf("could not create table %s, err: %w", tableName, err)
+			}
+		} else if err := s.CreateColumns(tableName, fields); err != nil {
+			return fmt.Errorf("could not create table columns  %s, err: %w", tableName, err)
+		}
+
+		if err := s.indexTable(tableName, fields); err != nil {
+			return err
+		}
+	}
+
+	if tableExists {
+		return nil
+	}
+
+	if err := s.AddColumn(name, parentName, name); err != nil {
+		return fmt.Errorf("could not create index %s with %s, err: %w", name, parentName, err)
+	}
+
+	s.setColumnType(parentName, utils.UniqueShortName(name), "UUID")
+	return s.ensureIndex(parentName, []string{utils.UniqueShortName(name)})
+}
+
+func (s *Service) numericStrings(meta *model.MessageMeta) bool {
+	if meta == nil {
+		return false
+	}
+	// Uint128 and Decimal fields of contracts with a schema are typed by the schema as NUMERIC
+	if _, ok := s.cfg.ContractSchemas[meta.CodeID]; ok {
+		return true
+	}
+	for _, codeID := range s.cfg.NumericStringCodeIDs {
+		if codeID == meta.CodeID {
+			return true
+		}
+	}
+	return false
+}
+
+// generateTablesForEntity infers the tables of an entity, message is set for objects holding a whole message,
+// like the root entity or a decoded Binary, whose single key is the message variant and not an enum
+func (s *Service) generateTablesForEntity(msg map[string]interface{}, name string, numericStrings, message bool) ([]string, map[string]interface{}) {
 	order := make([]string, 0)
 	relations := make([]string, 0)
 	entityMap := make(map[string]interface{})
 	rootEntity := make(map[string]interface{})
 
 	name = utils.DeleteS(name)
+	columns := s.columnNames(name, msg)
 
 	for k, v := range msg {
-		k = strcase.ToSnake(utils.DeleteS(k))
-		entityName := strcase.ToSnake(utils.DeleteS(fmt.Sprintf("%s %s", name, k)))
+		entityName := nestedName(name, k)
+		k = columns[k]
 		kind := reflect.ValueOf(v).Kind()
 
+		// type of an optional field is unknown until a message carries a value,
+		// the nullable column is added then by CreateColumns
+		if v == nil {
+			s.log.Debugf("Skip null field %s of %s", k, name)
+			continue
+		}
+
+		for _, t := range temporalColumns(k, v) {
+			rootEntity[t.column] = t.columnType
+		}
+
+		if n, ok := v.(json.Number); ok {
+			rootEntity[k] = utils.NumberType(n)
+			continue
+		}
+
 		switch kind {
 
 		case reflect.String:
-			rootEntity[k] = "TEXT"
+			if numericStrings && utils.IsNumericString(v.(string)) {
+				rootEntity[k] = "NUMERIC"
+			} else {
+				rootEntity[k] = "TEXT"
+			}
 
 		case reflect.Float64, reflect.Int:
 			rootEntity[k] = "BIGINT"
@@ -332,7 +681,17 @@ func (s *Service) generateTablesForEntity(msg map[string]interface{}, name strin
 			rootEntity[k] = "BOOLEAN"
 
 		case reflect.Map:
-			entityOrder, nestedEntity := s.generateTablesForEntity(v.(map[string]interface{}), entityName)
+			decoded := strings.HasSuffix(k, decodedSuffix)
+			if !message && !decoded {
+				s.observeVariant(name, k, v)
+			}
+			if s.isEnum(name, k, v) {
+				rootEntity[variantColumn(k)] = "TEXT"
+				rootEntity[k] = "JSONB"
+				continue
+			}
+
+			entityOrder, nestedEntity := s.generateTablesForEntity(v.(map[string]interface{}), entityName, numericStrings, decoded)
 			for key, e := range nestedEntity {
 				entityMap[key] = e
 			}
@@ -340,26 +699,21 @@ func (s *Service) generateTablesForEntity(msg map[string]interface{}, name strin
 			order = append(order, entityOrder...)
 
 		case reflect.Array, reflect.Slice:
-			isArray, arrayType := utils.IsArray(v.([]interface{}))
-
-			if isArray {
-				switch arrayType {
-				case "String":
-					rootEntity[k] = "TEXT[]"
-				case "Boolean":
-					rootEntity[k] = "BOOLEAN[]"
-				default:
-					fmt.Println("Uknown array type")
-					os.Exit(666)
-				}
+			val := v.([]interface{})
+			arrayType := utils.ArrayType(val)
 
-				s.log.Info("should break")
+			if arrayType == utils.ArrayEmpty {
+				// like null fields, empty arrays get their column with the first elements
+				s.log.Debugf("Skip empty array %s of %s", k, name)
 				continue
 			}
 
-			value := v.([]interface{})[0]
+			if arrayType != utils.ArrayObjects {
+				rootEntity[k] = arrayType
+				continue
+			}
 
-			entityOrder, nestedEntity := s.generateTablesForEntity(value.(map[string]interface{}), entityName)
+			entityOrder, nestedEntity := s.generateTablesForEntity(unionObject(val), entityName, numericStrings, false)
 			for k, e := range nestedEntity {
 				entityMap[k] = e
 			}
@@ -371,8 +725,7 @@ func (s *Service) generateTablesForEntity(msg map[string]interface{}, name strin
 			relations = append(relations, relationTableName)
 
 		default:
-			s.log.Debugf("Unhandled value type: %s key: %s", reflect.TypeOf(v).String(), k)
-			os.Exit(666)
+			s.log.Debugf("Skip field %s of unhandled type %s", k, reflect.TypeOf(v).String())
 		}
 
 	}
@@ -388,14 +741,22 @@ func (s *Service) getCodeId(codeId interface{}) string {
 
 	switch reflect.TypeOf(codeId) {
 	case reflect.TypeOf(map[string]interface{}{}):
-		code := codeId.(map[string]interface{})["low"].(float64)
-		return strconv.Itoa(int(code))
+		return s.getCodeId(codeId.(map[string]interface{})["low"])
+	case numberType:
+		return codeId.(json.Number).String()
+	case reflect.TypeOf(""):
+		return codeId.(string)
 	default:
 		s.log.Debugf("Unknown codeID type: %s", reflect.TypeOf(codeId).String())
 		return ""
 	}
 }
 
+// nestedName names the table of an object or array of objects under key
+func nestedName(name, key string) string {
+	return fmt.Sprintf("%s_%s", name, utils.ColumnName(utils.DeleteS(key)))
+}
+
 func relationTableFields(entityName, name string) map[string]interface{} {
 	en := utils.UniqueShortName(entityName)
 	n := utils.UniqueShortName(name)
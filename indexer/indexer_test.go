@@ -0,0 +1,210 @@
+package indexer_test
+
+import (
+	"database/sql/driver"
+	"os"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/suite"
+
+	"juno-contracts-worker/config"
+	"juno-contracts-worker/db"
+	"juno-contracts-worker/db/dbtest"
+	"juno-contracts-worker/db/model"
+	"juno-contracts-worker/indexer"
+)
+
+const entityName = "msg_instantiate_contract"
+
+type EntitySuite struct {
+	suite.Suite
+	fake    *dbtest.DB
+	indexer *indexer.Service
+}
+
+func (s *EntitySuite) SetupTest() {
+	s.setup(&config.Config{})
+}
+
+func (s *EntitySuite) setup(cfg *config.Config) {
+	conn, fake, err := dbtest.Open()
+	s.Require().NoError(err)
+	s.fake = fake
+
+	log := logrus.New()
+	log.SetOutput(os.Stderr)
+	s.indexer = indexer.New(nil, db.NewWithConn(log, conn), log, cfg)
+}
+
+// save saves msg as an instantiate message and returns the insert of its root entity
+func (s *EntitySuite) save(msg string, meta *model.MessageMeta) dbtest.Call {
+	s.Require().NoError(s.indexer.SaveJsonAsEntity("m1", entityName, msg, meta))
+
+	for _, c := range s.fake.Find(`INSERT INTO app."mic42_h`) {
+		if _, ok := c.Arg("tx_hash"); ok {
+			return c
+		}
+	}
+	s.FailNow("root entity is not saved", s.fake.Statements())
+	return dbtest.Call{}
+}
+
+func (s *EntitySuite) TestBlockTimeIsReadFromBlocks() {
+	s.fake.On(dbtest.Result{
+		Match:   `FROM app."blocks"`,
+		Columns: []string{"time"},
+		Rows:    [][]driver.Value{{"2022-07-01T10:00:00Z"}},
+	})
+
+	// a known block is not fetched from the node again
+	blockTime, err := s.indexer.BlockTime(100)
+	s.Require().NoError(err)
+	s.Equal("2022-07-01T10:00:00Z", blockTime)
+	s.Empty(s.fake.Find(`INSERT INTO app."blocks"`))
+}
+
+func (s *EntitySuite) TestBlockTimeIsSavedWithEntity() {
+	meta := &model.MessageMeta{TxSuccess: true, Height: 100, TxHash: "T", BlockTime: "2022-07-01T10:00:00Z"}
+	insert := s.save(`{"codeId": "42", "sender": "juno1", "msg": {"name": "token"}}`, meta)
+
+	blockTime, ok := insert.Arg("tx_block_time")
+	s.True(ok, insert.Statement)
+	s.Equal("2022-07-01T10:00:00Z", blockTime)
+}
+
+func (s *EntitySuite) TestNullFieldIsLeftNull() {
+	meta := &model.MessageMeta{TxSuccess: true, Height: 100, TxHash: "T"}
+	insert := s.save(`{"codeId": "42", "sender": "juno1", "msg": {"name": "token", "admin": null}}`, meta)
+
+	_, ok := insert.Arg("admin")
+	s.False(ok, insert.Statement)
+	s.Empty(s.fake.Find(`"admin"`))
+
+	// the column is added once a message sets the field
+	meta = &model.MessageMeta{TxSuccess: true, Height: 101, TxHash: "T2"}
+	s.Require().NoError(s.indexer.SaveJsonAsEntity("m2", entityName, `{"codeId": "42", "sender": "juno1", "msg": {"name": "token", "admin": "juno1admin"}}`, meta))
+	s.NotEmpty(s.fake.Find(`ADD COLUMN IF NOT EXISTS "admin"`), s.fake.Statements())
+}
+
+func (s *EntitySuite) TestRawMessageIsKept() {
+	msg := `{"codeId": "42", "sender": "juno1", "msg": {"name": "token", "unknown": [{"a": 1}, "b"]}}`
+	insert := s.save(msg, &model.MessageMeta{TxSuccess: true, Height: 100, TxHash: "T"})
+
+	raw, ok := insert.Arg("raw_msg")
+	s.True(ok, insert.Statement)
+	s.Equal(msg, raw)
+}
+
+func (s *EntitySuite) TestCollidingKeysGetSuffix() {
+	insert := s.save(`{"codeId": "42", "sender": "juno1", "msg": {"a-b": "x", "a_b": "y"}}`, &model.MessageMeta{TxSuccess: true, Height: 100, TxHash: "T"})
+
+	// the key that is its own column keeps it
+	plain, _ := insert.Arg("a_b")
+	s.Equal("y", plain)
+	suffixed, ok := insert.Arg("a_b_2")
+	s.True(ok, insert.Statement)
+	s.Equal("x", suffixed)
+
+	var names [][]driver.Value
+	for _, c := range s.fake.Find(`INSERT INTO app."name_map"`) {
+		short, _ := c.Arg("short_name")
+		full, _ := c.Arg("full_name")
+		names = append(names, []driver.Value{short, full})
+	}
+	s.Contains(names, []driver.Value{"a_b_2", "a-b"})
+}
+
+func (s *EntitySuite) TestRecordedColumnNamesAreKept() {
+	// a-b took a_b before the restart
+	s.fake.On(dbtest.Result{
+		Match:   `FROM app."name_map"`,
+		Columns: []string{"short_name", "full_name"},
+		Rows:    [][]driver.Value{{"a_b", "a-b"}},
+	})
+	insert := s.save(`{"codeId": "42", "sender": "juno1", "msg": {"a_b": "y"}}`, &model.MessageMeta{TxSuccess: true, Height: 100, TxHash: "T"})
+
+	_, ok := insert.Arg("a_b")
+	s.False(ok, insert.Statement)
+	suffixed, ok := insert.Arg("a_b_2")
+	s.True(ok, insert.Statement)
+	s.Equal("y", suffixed)
+}
+
+// inserted returns the arguments of column in the inserts of all tables
+func (s *EntitySuite) inserted(column string) []driver.Value {
+	var values []driver.Value
+	for _, c := range s.fake.Find("INSERT INTO") {
+		if v, ok := c.Arg(column); ok {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func (s *EntitySuite) TestKnownVariantIsEnum() {
+	s.save(`{"codeId": "42", "sender": "juno1", "msg": {"config": {"expires": {"at_height": 5}}}}`, &model.MessageMeta{TxSuccess: true, Height: 100, TxHash: "T"})
+
+	s.Equal([]driver.Value{"at_height"}, s.inserted("expire_variant"))
+	s.Equal([]driver.Value{"5"}, s.inserted("expire"))
+	s.NotEmpty(s.fake.Find(`INSERT INTO app."enum_fields"`))
+}
+
+func (s *EntitySuite) TestSingleKeyObjectIsNotEnum() {
+	// a struct with one field set looks like a variant, a different field is no reason to make it an enum
+	s.save(`{"codeId": "42", "sender": "juno1", "msg": {"config": {"limit": {"owner": "juno1"}}}}`, &model.MessageMeta{TxSuccess: true, Height: 100, TxHash: "T"})
+	s.save(`{"codeId": "42", "sender": "juno1", "msg": {"config": {"limit": {"admin": "juno2"}}}}`, &model.MessageMeta{TxSuccess: true, Height: 101, TxHash: "T2"})
+
+	s.Empty(s.inserted("limit_variant"))
+	s.Equal([]driver.Value{"juno2"}, s.inserted("admin"))
+	s.Empty(s.fake.Find(`INSERT INTO app."enum_fields"`))
+}
+
+func (s *EntitySuite) TestIndexIsCachedOnceValid() {
+	builds := func() int {
+		return len(s.fake.Find(`CREATE INDEX CONCURRENTLY IF NOT EXISTS "mic42_h3e5887a105_tx_hash_idx"`))
+	}
+
+	s.save(`{"codeId": "42", "sender": "juno1", "msg": {"name": "token"}}`, &model.MessageMeta{TxSuccess: true, Height: 100, TxHash: "T"})
+	s.Equal(1, builds())
+
+	// the build may have failed, it is started again until the index is valid
+	s.save(`{"codeId": "42", "sender": "juno1", "msg": {"name": "token"}}`, &model.MessageMeta{TxSuccess: true, Height: 101, TxHash: "T2"})
+	s.Equal(2, builds())
+
+	s.fake.On(dbtest.Result{Match: "FROM pg_index", Columns: []string{"indisvalid"}, Rows: [][]driver.Value{{true}}})
+	s.save(`{"codeId": "42", "sender": "juno1", "msg": {"name": "token"}}`, &model.MessageMeta{TxSuccess: true, Height: 102, TxHash: "T3"})
+	s.save(`{"codeId": "42", "sender": "juno1", "msg": {"name": "token"}}`, &model.MessageMeta{TxSuccess: true, Height: 103, TxHash: "T4"})
+	s.Equal(2, builds())
+}
+
+func (s *EntitySuite) TestSchemaIsRegistered() {
+	s.save(`{"codeId": "42", "sender": "juno1", "msg": {"name": "token"}}`, &model.MessageMeta{TxSuccess: true, Height: 100, TxHash: "T"})
+
+	versions := s.fake.Find(`INSERT INTO app."schema_registry"`)
+	s.Require().Len(versions, 1)
+	schema, _ := versions[0].Arg("schema")
+	// meta columns are not part of the schema
+	s.Contains(schema, `"name":"TEXT"`)
+	s.NotContains(schema, "tx_hash")
+}
+
+func (s *EntitySuite) TestQuarantinedMessageIsNotRegistered() {
+	s.setup(&config.Config{TypeConflicts: config.TypeConflictQuarantine})
+	s.fake.On(dbtest.Result{
+		Match:   "FROM information_schema.columns",
+		Columns: []string{"column_name", "udt_name"},
+		Rows:    [][]driver.Value{{"name", "int8"}},
+	})
+
+	meta := &model.MessageMeta{TxSuccess: true, Height: 100, TxHash: "T"}
+	s.Require().NoError(s.indexer.SaveJsonAsEntity("m1", entityName, `{"codeId": "42", "sender": "juno1", "msg": {"name": "token"}}`, meta))
+
+	s.Len(s.fake.Find(`INSERT INTO app."quarantine"`), 1)
+	s.Empty(s.fake.Find(`INSERT INTO app."schema_registry"`))
+	s.Empty(s.fake.Find(`INSERT INTO app."mic42_h`))
+}
+
+func TestEntitySuite(t *testing.T) {
+	suite.Run(t, new(EntitySuite))
+}
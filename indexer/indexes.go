@@ -0,0 +1,109 @@
+package indexer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/iancoleman/strcase"
+
+	"juno-contracts-worker/utils"
+)
+
+// hotColumns are filtered on by most queries of root entities
+var hotColumns = map[string]bool{
+	"tx_height": true,
+	"tx_hash":   true,
+	"height":    true,
+}
+
+// declaredIndexes maps tables to the column lists of indexes configured for their code ID
+func (s *Service) declaredIndexes() map[string][][]string {
+	declared := make(map[string][][]string)
+	for codeID, indexes := range s.cfg.Indexes {
+		for _, index := range indexes {
+			// names follow generateTablesForEntity, which drops the plural s at every level
+			name := fmt.Sprintf("%s_%s", strcase.ToSnake(utils.DeleteS(index.Message)), codeID)
+			for _, key := range index.Path {
+				name = utils.DeleteS(nestedName(name, key))
+			}
+
+			columns := make([]string, len(index.Columns))
+			for i, column := range index.Columns {
+				columns[i] = utils.ColumnName(column)
+			}
+			declared[name] = append(declared[name], columns)
+		}
+	}
+	return declared
+}
+
+// indexTable indexes foreign keys, relation columns, heights and tx hashes of a generated table
+// and the indexes declared for it
+func (s *Service) indexTable(tableName string, fields map[string]interface{}) error {
+	for k, v := range fields {
+		val, ok := v.(string)
+		if !ok || strings.Contains(k, " ") {
+			continue
+		}
+
+		switch {
+		case strings.Contains(val, "REFERENCES"):
+			k = utils.UniqueShortName(k)
+		case val == "UUID NOT NULL", hotColumns[k]:
+		default:
+			continue
+		}
+
+		if err := s.ensureIndex(tableName, []string{k}); err != nil {
+			return err
+		}
+	}
+
+	for _, columns := range s.declared[tableName] {
+		if err := s.ensureIndex(tableName, columns); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ensureIndex creates an index once, indexes of columns that do not exist yet are retried with later messages.
+// In a transaction the build only runs after the commit and may fail, so an index is cached once it is seen valid.
+func (s *Service) ensureIndex(tableName string, columns []string) error {
+	key := tableName + "/" + strings.Join(columns, ",")
+
+	s.mu.Lock()
+	indexed := s.cachedFlag(indexedOf, key)
+	s.mu.Unlock()
+	if indexed {
+		return nil
+	}
+
+	live, err := s.columnTypes(tableName)
+	if err != nil {
+		return fmt.Errorf("could not read column types of %s: %w", tableName, err)
+	}
+	for _, column := range columns {
+		if _, ok := live[column]; !ok {
+			return nil
+		}
+	}
+
+	indexName := fmt.Sprintf("%s_%s_idx", utils.UniqueShortName(tableName), strings.Join(columns, "_"))
+	valid, err := s.db.IndexValid(indexName)
+	if err != nil {
+		return fmt.Errorf("could not check index on %v of %s: %w", columns, tableName, err)
+	}
+	if !valid {
+		if err = s.db.CreateIndex(columns, indexName, tableName); err != nil {
+			return fmt.Errorf("could not create index on %v of %s: %w", columns, tableName, err)
+		}
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.writable().indexed[key] = true
+	return nil
+}
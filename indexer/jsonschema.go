@@ -0,0 +1,330 @@
+package indexer
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// numericDefinitions are cosmwasm types sent as strings that hold numbers
+var numericDefinitions = map[string]bool{
+	"Uint64":           true,
+	"Uint128":          true,
+	"Uint256":          true,
+	"Uint512":          true,
+	"Int64":            true,
+	"Int128":           true,
+	"Int256":           true,
+	"Int512":           true,
+	"Decimal":          true,
+	"Decimal256":       true,
+	"SignedDecimal":    true,
+	"SignedDecimal256": true,
+	"Timestamp":        true,
+}
+
+// JsonSchema is the subset of draft 7 generated by cosmwasm-schema
+type JsonSchema struct {
+	Ref                  string                 `json:"$ref"`
+	Type                 schemaTypes            `json:"type"`
+	Format               string                 `json:"format"`
+	Enum                 []interface{}          `json:"enum"`
+	Properties           map[string]*JsonSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties json.RawMessage        `json:"additionalProperties"`
+	Items                schemaItems            `json:"items"`
+	AnyOf                []*JsonSchema          `json:"anyOf"`
+	OneOf                []*JsonSchema          `json:"oneOf"`
+	AllOf                []*JsonSchema          `json:"allOf"`
+	Definitions          map[string]*JsonSchema `json:"definitions"`
+	Defs                 map[string]*JsonSchema `json:"$defs"`
+}
+
+// schemaTypes accepts both "type": "string" and "type": ["string", "null"]
+type schemaTypes []string
+
+func (t *schemaTypes) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = schemaTypes{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*t = list
+	return nil
+}
+
+// schemaItems accepts a schema for all elements or a list of schemas for tuples
+type schemaItems struct {
+	all   *JsonSchema
+	tuple []*JsonSchema
+}
+
+func (i *schemaItems) UnmarshalJSON(data []byte) error {
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "[") {
+		return json.Unmarshal(data, &i.tuple)
+	}
+	return json.Unmarshal(data, &i.all)
+}
+
+func ParseJsonSchema(data []byte) (*JsonSchema, error) {
+	var schema JsonSchema
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, err
+	}
+	return &schema, nil
+}
+
+// resolve follows $ref into the definitions of the root schema
+func (root *JsonSchema) resolve(s *JsonSchema) (*JsonSchema, string) {
+	if s.Ref == "" {
+		return s, ""
+	}
+
+	name := s.Ref[strings.LastIndex(s.Ref, "/")+1:]
+	if d, ok := root.Definitions[name]; ok {
+		return d, name
+	}
+	if d, ok := root.Defs[name]; ok {
+		return d, name
+	}
+	return &JsonSchema{}, name
+}
+
+func hasType(s *JsonSchema, t string) bool {
+	for _, st := range s.Type {
+		if st == t {
+			return true
+		}
+	}
+	return false
+}
+
+func closed(s *JsonSchema) bool {
+	return strings.TrimSpace(string(s.AdditionalProperties)) == "false"
+}
+
+// Sample builds a message with every field the schema allows, enum variants are merged into one object.
+// The indexer infers tables from the sample like from a real message.
+func (root *JsonSchema) Sample() interface{} {
+	return root.sample(root, map[string]bool{})
+}
+
+func (root *JsonSchema) sample(s *JsonSchema, visiting map[string]bool) interface{} {
+	s, name := root.resolve(s)
+	if name != "" {
+		if numericDefinitions[name] {
+			return "0"
+		}
+		// recursive types are left to inference from real messages
+		if visiting[name] {
+			return nil
+		}
+		visiting[name] = true
+		defer delete(visiting, name)
+	}
+
+	if variants := append(append([]*JsonSchema{}, s.AnyOf...), s.OneOf...); len(variants) > 0 {
+		return root.sampleVariants(variants, visiting)
+	}
+
+	if len(s.AllOf) > 0 {
+		return root.sampleVariants(s.AllOf, visiting)
+	}
+
+	switch {
+	case hasType(s, "object"):
+		if len(s.Properties) == 0 {
+			return nil
+		}
+		obj := make(map[string]interface{})
+		for k, p := range s.Properties {
+			if v := root.sample(p, visiting); v != nil {
+				obj[k] = v
+			}
+		}
+		return obj
+
+	case hasType(s, "array"):
+		arr := make([]interface{}, 0)
+		if s.Items.all != nil {
+			if v := root.sample(s.Items.all, visiting); v != nil {
+				arr = append(arr, v)
+			}
+		}
+		for _, item := range s.Items.tuple {
+			if v := root.sample(item, visiting); v != nil {
+				arr = append(arr, v)
+			}
+		}
+		return arr
+
+	case hasType(s, "string"):
+		return ""
+
+	case hasType(s, "integer"):
+		return json.Number("0")
+
+	case hasType(s, "number"):
+		return json.Number("0.5")
+
+	case hasType(s, "boolean"):
+		return false
+
+	default:
+		return nil
+	}
+}
+
+// sampleVariants merges object variants, unit variants and other scalars are used only when no variant is an object
+func (root *JsonSchema) sampleVariants(variants []*JsonSchema, visiting map[string]bool) interface{} {
+	var merged map[string]interface{}
+	var scalar interface{}
+
+	for _, variant := range variants {
+		switch v := root.sample(variant, visiting).(type) {
+		case nil:
+			continue
+		case map[string]interface{}:
+			if merged == nil {
+				merged = make(map[string]interface{})
+			}
+			mergeSample(merged, v)
+		default:
+			if scalar == nil {
+				scalar = v
+			}
+		}
+	}
+
+	if merged != nil {
+		return merged
+	}
+	return scalar
+}
+
+func mergeSample(dst, src map[string]interface{}) {
+	for k, v := range src {
+		current, ok := dst[k]
+		if !ok {
+			dst[k] = v
+			continue
+		}
+
+		currentMap, ok := current.(map[string]interface{})
+		srcMap, srcOk := v.(map[string]interface{})
+		if ok && srcOk {
+			mergeSample(currentMap, srcMap)
+		}
+	}
+}
+
+// Validate returns the places where msg does not match the schema, numbers are expected as json.Number
+func (root *JsonSchema) Validate(msg interface{}) []string {
+	return root.validate(root, msg, "msg")
+}
+
+func (root *JsonSchema) validate(s *JsonSchema, v interface{}, path string) []string {
+	s, _ = root.resolve(s)
+
+	for _, sub := range s.AllOf {
+		if errs := root.validate(sub, v, path); len(errs) > 0 {
+			return errs
+		}
+	}
+
+	if variants := append(append([]*JsonSchema{}, s.AnyOf...), s.OneOf...); len(variants) > 0 {
+		for _, variant := range variants {
+			if len(root.validate(variant, v, path)) == 0 {
+				return nil
+			}
+		}
+		return []string{fmt.Sprintf("%s: matches no variant", path)}
+	}
+
+	if len(s.Enum) > 0 && !inEnum(s.Enum, v) {
+		return []string{fmt.Sprintf("%s: %v is not one of %v", path, v, s.Enum)}
+	}
+
+	if len(s.Type) > 0 && !hasType(s, jsonType(v)) && !(jsonType(v) == "integer" && hasType(s, "number")) {
+		return []string{fmt.Sprintf("%s: expected %s, got %s", path, strings.Join(s.Type, " or "), jsonType(v))}
+	}
+
+	var errs []string
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for _, k := range s.Required {
+			if _, ok := val[k]; !ok {
+				errs = append(errs, fmt.Sprintf("%s.%s: missing required field", path, k))
+			}
+		}
+
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			p, ok := s.Properties[k]
+			if !ok {
+				if closed(s) {
+					errs = append(errs, fmt.Sprintf("%s.%s: unknown field", path, k))
+				}
+				continue
+			}
+			errs = append(errs, root.validate(p, val[k], path+"."+k)...)
+		}
+
+	case []interface{}:
+		for i, item := range val {
+			itemPath := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case s.Items.all != nil:
+				errs = append(errs, root.validate(s.Items.all, item, itemPath)...)
+			case i < len(s.Items.tuple):
+				errs = append(errs, root.validate(s.Items.tuple[i], item, itemPath)...)
+			}
+		}
+	}
+
+	return errs
+}
+
+func jsonType(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if strings.ContainsAny(val.String(), ".eE") {
+			return "number"
+		}
+		return "integer"
+	case float64:
+		return "number"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+func inEnum(enum []interface{}, v interface{}) bool {
+	for _, e := range enum {
+		if fmt.Sprintf("%v", e) == fmt.Sprintf("%v", v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package indexer_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"juno-contracts-worker/indexer"
+)
+
+const executeMsgSchema = `{
+	"oneOf": [
+		{
+			"type": "object",
+			"required": ["transfer"],
+			"properties": {
+				"transfer": {
+					"type": "object",
+					"required": ["amount", "recipient"],
+					"properties": {
+						"amount": {"$ref": "#/definitions/Uint128"},
+						"recipient": {"type": "string"}
+					},
+					"additionalProperties": false
+				}
+			},
+			"additionalProperties": false
+		},
+		{
+			"type": "object",
+			"required": ["burn"],
+			"properties": {
+				"burn": {
+					"type": "object",
+					"required": ["amount"],
+					"properties": {
+						"amount": {"$ref": "#/definitions/Uint128"},
+						"memo": {"type": ["string", "null"]}
+					},
+					"additionalProperties": false
+				}
+			},
+			"additionalProperties": false
+		}
+	],
+	"definitions": {
+		"Uint128": {"type": "string"}
+	}
+}`
+
+type JsonSchema struct {
+	suite.Suite
+	schema *indexer.JsonSchema
+}
+
+func (j *JsonSchema) SetupTest() {
+	schema, err := indexer.ParseJsonSchema([]byte(executeMsgSchema))
+	j.Require().NoError(err)
+	j.schema = schema
+}
+
+func (j *JsonSchema) TestSampleMergesVariants() {
+	sample := j.schema.Sample().(map[string]interface{})
+
+	j.Equal(map[string]interface{}{"amount": "0", "recipient": ""}, sample["transfer"])
+
+	j.Equal(map[string]interface{}{"amount": "0", "memo": ""}, sample["burn"])
+}
+
+func (j *JsonSchema) TestValidate() {
+	j.Empty(j.schema.Validate(decode(`{"transfer": {"amount": "10", "recipient": "juno1"}}`)))
+
+	j.Empty(j.schema.Validate(decode(`{"burn": {"amount": "10", "memo": null}}`)))
+
+	j.NotEmpty(j.schema.Validate(decode(`{"transfer": {"amount": 10, "recipient": "juno1"}}`)))
+
+	j.NotEmpty(j.schema.Validate(decode(`{"mint": {"amount": "10"}}`)))
+}
+
+func decode(msg string) interface{} {
+	var v interface{}
+	decoder := json.NewDecoder(strings.NewReader(msg))
+	decoder.UseNumber()
+	if err := decoder.Decode(&v); err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func TestJsonSchema(t *testing.T) {
+	suite.Run(t, new(JsonSchema))
+}
@@ -0,0 +1,269 @@
+package indexer
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/google/uuid"
+
+	"juno-contracts-worker/db/model"
+	"juno-contracts-worker/utils"
+)
+
+const nameMapTableName = "name_map"
+
+func (s *Service) initNameMap() error {
+	nameFields := map[string]interface{}{
+		"table_name": "TEXT",
+		"short_name": "TEXT",
+		"full_name":  "TEXT",
+	}
+
+	if err := s.db.CreateTable(nameMapTableName, nameFields); err != nil {
+		return fmt.Errorf("could not create table %s: %w", nameMapTableName, err)
+	}
+
+	if err := s.db.CreateUniqueIndex([]string{"table_name", "short_name"}, nameMapTableName+"_name_idx", nameMapTableName); err != nil {
+		return fmt.Errorf("could not create index on table %s: %w", nameMapTableName, err)
+	}
+
+	return nil
+}
+
+// recordName keeps the full name of a shortened table so tools can resolve it
+func (s *Service) recordName(name string) error {
+	shortName := utils.UniqueShortName(name)
+	if shortName == name {
+		return nil
+	}
+	return s.saveName("", shortName, name)
+}
+
+// columnNames maps the json keys of an entity object to their columns. Keys that normalize to the same
+// column, like a-b and a_b, fooBar and foo_bar or amounts and amount, get a numbered suffix. The column of
+// every key is recorded in name_map with its table, so a key keeps its column after a restart.
+func (s *Service) columnNames(name string, msg map[string]interface{}) map[string]string {
+	tableName := utils.UniqueShortName(name)
+	if err := s.loadColumnNames(tableName); err != nil {
+		s.log.Warn(err)
+	}
+
+	// keys that are their own column go first, so a new key colliding with them gets the suffix
+	keys := make([]string, 0, len(msg))
+	for k := range msg {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		iPlain, jPlain := keys[i] == baseColumn(keys[i]), keys[j] == baseColumn(keys[j])
+		if iPlain != jPlain {
+			return iPlain
+		}
+		return keys[i] < keys[j]
+	})
+
+	columns := make(map[string]string, len(keys))
+	for _, k := range keys {
+		columns[k] = s.columnName(tableName, k)
+	}
+	return columns
+}
+
+// columnName returns the column of a key, a key seen for the first time takes the first free column
+func (s *Service) columnName(tableName, key string) string {
+	// the id column of every entity is set by saveJson
+	if key == "id" {
+		return key
+	}
+
+	base := baseColumn(key)
+	s.mu.Lock()
+	if column, ok := s.cachedName(keyColumnsOf, tableName+"/"+key); ok {
+		s.mu.Unlock()
+		return column
+	}
+
+	column := base
+	for n := 2; s.columnTaken(tableName, column); n++ {
+		column = fmt.Sprintf("%s_%d", base, n)
+	}
+	w := s.writable()
+	w.keyColumns[tableName+"/"+key] = column
+	w.columnKeys[tableName+"/"+column] = key
+	s.mu.Unlock()
+
+	if column != base {
+		s.log.Infof("Key %s of %s collides with another key, saved in column %s", key, tableName, column)
+	}
+	if err := s.saveName(tableName, column, key); err != nil {
+		s.log.Warn(err)
+	}
+
+	return column
+}
+
+// knownColumnName returns the column of a key without taking one for a new key
+func (s *Service) knownColumnName(name, key string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if column, ok := s.cachedName(keyColumnsOf, utils.UniqueShortName(name)+"/"+key); ok {
+		return column
+	}
+	return baseColumn(key)
+}
+
+// columnTaken reports whether another key has the column, the lock is held by the caller
+func (s *Service) columnTaken(tableName, column string) bool {
+	_, taken := s.cachedName(columnKeysOf, tableName+"/"+column)
+	return taken || column == "id"
+}
+
+// loadColumnNames reads the columns of the keys of a table from name_map once
+func (s *Service) loadColumnNames(tableName string) error {
+	var column, key string
+	loaded := "columns/" + tableName
+	s.mu.Lock()
+	known := s.cachedFlag(namesOf, loaded)
+	s.mu.Unlock()
+	if known {
+		return nil
+	}
+
+	qParams := &model.QParameters{Fields: map[string]any{"table_name": tableName}}
+	rows, err := s.db.Select(nameMapTableName, []string{"short_name", "full_name"}, qParams)
+	if err != nil {
+		return fmt.Errorf("could not read column names of %s: %w", tableName, err)
+	}
+	defer rows.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w := s.writable()
+	for rows.Next() {
+		if err = rows.Scan(&column, &key); err != nil {
+			return err
+		}
+		w.keyColumns[tableName+"/"+key] = column
+		w.columnKeys[tableName+"/"+column] = key
+	}
+	w.names[loaded] = true
+
+	return rows.Err()
+}
+
+func baseColumn(key string) string {
+	return utils.ColumnName(utils.DeleteS(key))
+}
+
+// renameLegacyTables renames the tables of an entity that were created before names got a hash,
+// with their columns named after generated tables, the link column of the root is in parentName
+func (s *Service) renameLegacyTables(order []string, name, parentName string) error {
+	// columns are named after tables with or without the plural s
+	names := make([]string, 0, 2*len(order))
+	for _, tableName := range order {
+		names = append(names, tableName, tableName+"s")
+	}
+
+	for _, tableName := range order {
+		renamed, err := s.renameLegacyTable(tableName)
+		if err != nil {
+			return err
+		}
+		if !renamed {
+			continue
+		}
+
+		if err = s.renameLegacyColumns(tableName, names); err != nil {
+			return err
+		}
+		if tableName == utils.DeleteS(name) {
+			if err = s.renameLegacyColumns(parentName, []string{name}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *Service) renameLegacyTable(name string) (bool, error) {
+	shortName, legacyName := utils.UniqueShortName(name), utils.LegacyShortName(name)
+	if shortName == legacyName {
+		return false, nil
+	}
+
+	checked := "legacy/" + shortName
+	s.mu.Lock()
+	known := s.cachedFlag(namesOf, checked)
+	s.mu.Unlock()
+	if known {
+		return false, nil
+	}
+
+	exists, err := s.db.TableExists(shortName)
+	if err != nil {
+		return false, err
+	}
+	legacyExists := false
+	if !exists {
+		if legacyExists, err = s.db.TableExists(legacyName); err != nil {
+			return false, err
+		}
+	}
+
+	var columns map[string]string
+	if legacyExists {
+		if err = s.db.RenameTable(legacyName, shortName); err != nil {
+			return false, fmt.Errorf("could not rename table %s to %s: %w", legacyName, shortName, err)
+		}
+		s.log.Infof("Renamed table %s to %s", legacyName, shortName)
+
+		if err = s.recordName(name); err != nil {
+			return false, err
+		}
+		// columns of the table may be cached from when it did not exist yet
+		if columns, err = s.db.ColumnTypes(shortName); err != nil {
+			return false, err
+		}
+	}
+
+	s.mu.Lock()
+	s.writable().names[checked] = true
+	if columns != nil {
+		s.writable().columns[shortName] = columns
+	}
+	s.mu.Unlock()
+	return legacyExists, nil
+}
+
+func (s *Service) renameLegacyColumns(tableName string, names []string) error {
+	live, err := s.columnTypes(tableName)
+	if err != nil {
+		return fmt.Errorf("could not read column types of %s: %w", tableName, err)
+	}
+
+	for _, name := range names {
+		shortName, legacyName := utils.UniqueShortName(name), utils.LegacyShortName(name)
+		columnType, isLegacy := live[legacyName]
+		if _, exists := live[shortName]; shortName == legacyName || !isLegacy || exists {
+			continue
+		}
+
+		if err = s.db.RenameColumn(utils.UniqueShortName(tableName), legacyName, shortName); err != nil {
+			return fmt.Errorf("could not rename column %s of %s: %w", legacyName, tableName, err)
+		}
+		live[shortName] = columnType
+		s.setColumnType(tableName, shortName, columnType)
+	}
+
+	return nil
+}
+
+func (s *Service) saveName(tableName, shortName, fullName string) error {
+	id := uuid.NewSHA1(uuid.NameSpaceOID, []byte(fmt.Sprintf("%s/%s/%s", nameMapTableName, tableName, shortName)))
+	fields := []string{"id", "table_name", "short_name", "full_name"}
+	if err := s.db.Insert(nameMapTableName, fields, []any{id, tableName, shortName, fullName}); err != nil {
+		return fmt.Errorf("could not record name of %s: %w", fullName, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package indexer
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"juno-contracts-worker/db"
+	"juno-contracts-worker/db/model"
+)
+
+const rawMessagesTableName = "raw_messages"
+
+func (s *Service) initRawTable() error {
+	rawFields := map[string]interface{}{
+		"code_id":          "TEXT",
+		"contract_address": "TEXT",
+		"sender":           "TEXT",
+		"msg":              "JSONB",
+		"height":           "NUMERIC",
+		"tx_hash":          "TEXT",
+		"msg_index":        "INT",
+	}
+
+	if err := s.db.CreateTable(rawMessagesTableName, rawFields); err != nil {
+		return fmt.Errorf("could not create table %s: %w", rawMessagesTableName, err)
+	}
+
+	if err := s.db.CreateIndex([]string{"contract_address"}, rawMessagesTableName+"_contract_idx", rawMessagesTableName); err != nil {
+		return fmt.Errorf("could not create index on table %s: %w", rawMessagesTableName, err)
+	}
+
+	return nil
+}
+
+// RawDecoder keeps messages as JSON in raw_messages, for contracts whose messages would spread over too many tables
+type RawDecoder struct{}
+
+func (RawDecoder) Name() string {
+	return "raw"
+}
+
+func (RawDecoder) Decode(d db.ServiceInterface, meta *model.MessageMeta, msg map[string]interface{}) (map[string]interface{}, error) {
+	// the message position is the only key of a raw message, without it the generic path saves it
+	if meta == nil {
+		return msg, nil
+	}
+
+	bytes, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	id := uuid.NewSHA1(uuid.NameSpaceOID, []byte(fmt.Sprintf("%s/%s/%d", rawMessagesTableName, meta.TxHash, meta.MsgIndex)))
+	fields := []string{"id", "code_id", "contract_address", "sender", "msg", "height", "tx_hash", "msg_index"}
+	values := []any{id, meta.CodeID, meta.ContractAddress, meta.Sender, string(bytes), meta.Height, meta.TxHash, meta.MsgIndex}
+	if err = d.Insert(rawMessagesTableName, fields, values); err != nil {
+		return nil, fmt.Errorf("could not save raw message of tx %s: %w", meta.TxHash, err)
+	}
+
+	return nil, nil
+}
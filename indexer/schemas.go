@@ -0,0 +1,248 @@
+package indexer
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"juno-contracts-worker/db/model"
+	"juno-contracts-worker/utils"
+)
+
+const schemaRegistryTableName = "schema_registry"
+
+// Schema maps tables of an entity to their columns and types
+type Schema map[string]map[string]string
+
+// SchemaChange is a column added to an entity or widened, From is empty for new columns
+type SchemaChange struct {
+	Table  string `json:"table"`
+	Column string `json:"column"`
+	From   string `json:"from,omitempty"`
+	To     string `json:"to"`
+}
+
+// SchemaVersion is the shape of an entity after the change first seen at Height
+type SchemaVersion struct {
+	CodeID  string
+	Entity  string
+	Version int
+	Height  int64
+	TxHash  string
+	Schema  Schema
+	Diff    []SchemaChange
+}
+
+func (s *Service) initSchemaRegistry() error {
+	registryFields := map[string]interface{}{
+		"code_id":           "TEXT",
+		"entity":            "TEXT",
+		"version":           "INT",
+		"first_seen_height": "NUMERIC",
+		"tx_hash":           "TEXT",
+		"schema":            "JSONB",
+		"diff":              "JSONB",
+	}
+
+	if err := s.db.CreateTable(schemaRegistryTableName, registryFields); err != nil {
+		return fmt.Errorf("could not create table %s: %w", schemaRegistryTableName, err)
+	}
+
+	if err := s.db.CreateUniqueIndex([]string{"code_id", "entity", "version"}, schemaRegistryTableName+"_version_idx", schemaRegistryTableName); err != nil {
+		return fmt.Errorf("could not create index on table %s: %w", schemaRegistryTableName, err)
+	}
+
+	return nil
+}
+
+// observedSchema takes the columns inferred from one message, constraints are left out
+func observedSchema(tables map[string]interface{}) Schema {
+	schema := make(Schema)
+	for tableName, fields := range tables {
+		columns := make(map[string]string)
+		for k, v := range fields.(map[string]interface{}) {
+			if val, ok := v.(string); ok && !strings.Contains(k, " ") {
+				columns[k] = val
+			}
+		}
+		schema[tableName] = columns
+	}
+	return schema
+}
+
+// merge returns the schema holding both shapes and the changes it needs, types widen like live columns do
+func (sc Schema) merge(observed Schema) (Schema, []SchemaChange) {
+	merged := make(Schema)
+	for tableName, columns := range sc {
+		merged[tableName] = make(map[string]string)
+		for k, v := range columns {
+			merged[tableName][k] = v
+		}
+	}
+
+	var diff []SchemaChange
+	for tableName, columns := range observed {
+		if _, ok := merged[tableName]; !ok {
+			merged[tableName] = make(map[string]string)
+		}
+
+		for k, v := range columns {
+			current, ok := merged[tableName][k]
+			if !ok {
+				merged[tableName][k] = v
+				diff = append(diff, SchemaChange{Table: tableName, Column: k, To: v})
+				continue
+			}
+
+			if widened := utils.WidenType(current, v); widened != current {
+				merged[tableName][k] = widened
+				diff = append(diff, SchemaChange{Table: tableName, Column: k, From: current, To: widened})
+			}
+		}
+	}
+
+	sort.Slice(diff, func(i, j int) bool {
+		if diff[i].Table != diff[j].Table {
+			return diff[i].Table < diff[j].Table
+		}
+		return diff[i].Column < diff[j].Column
+	})
+
+	return merged, diff
+}
+
+// registerSchema saves a new version of the entity schema when the message adds or widens columns
+func (s *Service) registerSchema(name string, observed Schema, meta *model.MessageMeta) error {
+	var codeID, txHash string
+	var height int64
+	if meta != nil {
+		codeID, txHash, height = meta.CodeID, meta.TxHash, int64(meta.Height)
+	}
+
+	s.schemaMu.Lock()
+	defer s.schemaMu.Unlock()
+
+	key := codeID + "/" + name
+	current, ok := s.cachedSchema(key)
+	if !ok {
+		latest, err := s.latestSchema(codeID, name)
+		if err != nil {
+			return fmt.Errorf("could not read schema of %s code %s: %w", name, codeID, err)
+		}
+		current = latest
+	}
+
+	merged, diff := current.Schema.merge(observed)
+	if len(diff) == 0 {
+		s.cacheSchema(key, current)
+		return nil
+	}
+
+	next := SchemaVersion{
+		CodeID:  codeID,
+		Entity:  name,
+		Version: current.Version + 1,
+		Height:  height,
+		TxHash:  txHash,
+		Schema:  merged,
+		Diff:    diff,
+	}
+	if err := s.saveSchema(next); err != nil {
+		return err
+	}
+
+	s.log.Infof("Schema of %s code %s is at version %d, %d changes", name, codeID, next.Version, len(diff))
+	s.cacheSchema(key, next)
+	return nil
+}
+
+func (s *Service) saveSchema(v SchemaVersion) error {
+	schema, err := json.Marshal(v.Schema)
+	if err != nil {
+		return err
+	}
+	diff, err := json.Marshal(v.Diff)
+	if err != nil {
+		return err
+	}
+
+	id := uuid.NewSHA1(uuid.NameSpaceOID, []byte(fmt.Sprintf("%s/%s/%s/%d", schemaRegistryTableName, v.CodeID, v.Entity, v.Version)))
+	fields := []string{"id", "code_id", "entity", "version", "first_seen_height", "tx_hash", "schema", "diff"}
+	values := []any{id, v.CodeID, v.Entity, v.Version, v.Height, v.TxHash, string(schema), string(diff)}
+	if err = s.db.Insert(schemaRegistryTableName, fields, values); err != nil {
+		return fmt.Errorf("could not save schema version %d of %s: %w", v.Version, v.Entity, err)
+	}
+
+	return nil
+}
+
+func (s *Service) latestSchema(codeID, name string) (SchemaVersion, error) {
+	limit := int32(1)
+	versions, err := s.schemaVersions(codeID, name, &limit)
+	if err != nil || len(versions) == 0 {
+		return SchemaVersion{CodeID: codeID, Entity: name}, err
+	}
+	return versions[0], nil
+}
+
+// SchemaHistory returns all versions of an entity ordered by code ID and version, an empty code ID matches all code IDs
+func (s *Service) SchemaHistory(codeID, name string) ([]SchemaVersion, error) {
+	versions, err := s.schemaVersions(codeID, name, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		if versions[i].CodeID != versions[j].CodeID {
+			return versions[i].CodeID < versions[j].CodeID
+		}
+		return versions[i].Version < versions[j].Version
+	})
+
+	return versions, nil
+}
+
+func (s *Service) schemaVersions(codeID, name string, limit *int32) ([]SchemaVersion, error) {
+	qFields := map[string]any{
+		"entity": name,
+	}
+	if codeID != "" || limit != nil {
+		qFields["code_id"] = codeID
+	}
+	orderBy := []model.Order{
+		{Column: "version", Desc: true},
+	}
+	qParams := &model.QParameters{
+		Fields:  qFields,
+		OrderBy: orderBy,
+		Limit:   limit,
+	}
+
+	fields := []string{"code_id", "version", "first_seen_height", "tx_hash", "schema", "diff"}
+	rows, err := s.db.Select(schemaRegistryTableName, fields, qParams)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []SchemaVersion
+	for rows.Next() {
+		var schema, diff []byte
+		v := SchemaVersion{Entity: name}
+		if err = rows.Scan(&v.CodeID, &v.Version, &v.Height, &v.TxHash, &schema, &diff); err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(schema, &v.Schema); err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(diff, &v.Diff); err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+
+	return versions, rows.Err()
+}
@@ -0,0 +1,103 @@
+package indexer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// temporal is a typed column materialized next to a cw-utils Expiration, Duration or Timestamp value
+type temporal struct {
+	column     string
+	columnType string
+	value      any
+}
+
+// temporalColumns returns the typed columns of a field, values are nil when the variant does not set them
+func temporalColumns(column string, v interface{}) []temporal {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		variant, payload, ok := variantOf(val)
+		if !ok {
+			return nil
+		}
+
+		switch variant {
+		// Expiration
+		case "at_height", "at_time", "never":
+			expiration := []temporal{
+				{column: column + "_at_height", columnType: "BIGINT"},
+				{column: column + "_at_time", columnType: "TIMESTAMPTZ"},
+			}
+			switch variant {
+			case "at_height":
+				expiration[0].value = numberValue(payload)
+			case "at_time":
+				expiration[1].value = timestampValue(payload)
+			}
+			return expiration
+
+		// Duration
+		case "height", "time":
+			n := numberValue(payload)
+			if n == nil {
+				return nil
+			}
+			duration := []temporal{
+				{column: column + "_height", columnType: "BIGINT"},
+				{column: column + "_interval", columnType: "INTERVAL"},
+			}
+			if variant == "height" {
+				duration[0].value = n
+			} else {
+				duration[1].value = fmt.Sprintf("%s seconds", n)
+			}
+			return duration
+		}
+
+	case string:
+		if !isTimeKey(column) {
+			return nil
+		}
+		if value := timestampValue(val); value != nil {
+			return []temporal{{column: column + "_timestamp", columnType: "TIMESTAMPTZ", value: value}}
+		}
+	}
+
+	return nil
+}
+
+func isTimeKey(column string) bool {
+	return strings.Contains(column, "time") || strings.HasSuffix(column, "_at") ||
+		strings.HasPrefix(column, "expire") || strings.HasPrefix(column, "start") || strings.HasPrefix(column, "end")
+}
+
+func numberValue(v interface{}) any {
+	switch n := v.(type) {
+	case json.Number:
+		return n.String()
+	case string:
+		if _, err := strconv.ParseUint(n, 10, 64); err == nil {
+			return n
+		}
+	}
+	return nil
+}
+
+// timestampValue converts a cosmwasm Timestamp, nanoseconds since epoch sent as a string,
+// only 19 digit values are taken so amounts are not mistaken for times
+func timestampValue(v interface{}) any {
+	s, ok := v.(string)
+	if !ok || len(s) != 19 {
+		return nil
+	}
+
+	ns, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return nil
+	}
+
+	return time.Unix(0, ns).UTC().Format(time.RFC3339Nano)
+}
@@ -0,0 +1,83 @@
+package indexer_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"juno-contracts-worker/indexer"
+)
+
+type TemporalSuite struct {
+	suite.Suite
+}
+
+func expiration(height, time any) []indexer.Temporal {
+	return []indexer.Temporal{
+		{Column: "expires_at_height", Type: "BIGINT", Value: height},
+		{Column: "expires_at_time", Type: "TIMESTAMPTZ", Value: time},
+	}
+}
+
+func duration(height, interval any) []indexer.Temporal {
+	return []indexer.Temporal{
+		{Column: "period_height", Type: "BIGINT", Value: height},
+		{Column: "period_interval", Type: "INTERVAL", Value: interval},
+	}
+}
+
+func (s *TemporalSuite) TestTemporalColumns() {
+	tests := []struct {
+		name    string
+		column  string
+		value   interface{}
+		columns []indexer.Temporal
+	}{
+		// Expiration
+		{"at height", "expires", map[string]interface{}{"at_height": json.Number("123")}, expiration("123", nil)},
+		{"at height as string", "expires", map[string]interface{}{"at_height": "123"}, expiration("123", nil)},
+		{"at negative height", "expires", map[string]interface{}{"at_height": "-1"}, expiration(nil, nil)},
+		{"at time", "expires", map[string]interface{}{"at_time": "1656669600000000000"}, expiration(nil, "2022-07-01T10:00:00Z")},
+		{"at time with nanoseconds", "expires", map[string]interface{}{"at_time": "1656669600000000001"}, expiration(nil, "2022-07-01T10:00:00.000000001Z")},
+		{"at time in seconds", "expires", map[string]interface{}{"at_time": "1656669600"}, expiration(nil, nil)},
+		{"at time as number", "expires", map[string]interface{}{"at_time": json.Number("1656669600000000000")}, expiration(nil, nil)},
+		{"at time out of range", "expires", map[string]interface{}{"at_time": "9999999999999999999"}, expiration(nil, nil)},
+		{"never", "expires", map[string]interface{}{"never": map[string]interface{}{}}, expiration(nil, nil)},
+
+		// Duration
+		{"height duration", "period", map[string]interface{}{"height": json.Number("100")}, duration("100", nil)},
+		{"time duration", "period", map[string]interface{}{"time": json.Number("3600")}, duration(nil, "3600 seconds")},
+		{"zero time duration", "period", map[string]interface{}{"time": json.Number("0")}, duration(nil, "0 seconds")},
+		{"time duration as string", "period", map[string]interface{}{"time": "3600"}, duration(nil, "3600 seconds")},
+		{"duration without number", "period", map[string]interface{}{"time": map[string]interface{}{"seconds": 1}}, nil},
+		{"height duration as float", "period", map[string]interface{}{"height": float64(100)}, nil},
+
+		// Timestamp
+		{"timestamp of a time key", "end_time", "1656669600000000000", []indexer.Temporal{
+			{Column: "end_time_timestamp", Type: "TIMESTAMPTZ", Value: "2022-07-01T10:00:00Z"},
+		}},
+		{"timestamp of an _at key", "created_at", "1656669600000000000", []indexer.Temporal{
+			{Column: "created_at_timestamp", Type: "TIMESTAMPTZ", Value: "2022-07-01T10:00:00Z"},
+		}},
+		{"timestamp of another key", "amount", "1656669600000000000", nil},
+		{"short number of a time key", "start", "1000000", nil},
+		{"text of a time key", "end_time", "tomorrow at 10", nil},
+
+		// other values
+		{"other variant", "expires", map[string]interface{}{"at_block": json.Number("1")}, nil},
+		{"object with two keys", "expires", map[string]interface{}{"at_height": json.Number("1"), "at_time": "1656669600000000000"}, nil},
+		{"number", "expires", json.Number("1"), nil},
+		{"nil", "expires", nil, nil},
+	}
+
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			s.Equal(tt.columns, indexer.TemporalColumns(tt.column, tt.value))
+		})
+	}
+}
+
+func TestTemporalSuite(t *testing.T) {
+	suite.Run(t, new(TemporalSuite))
+}
@@ -0,0 +1,316 @@
+package projector
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/sirupsen/logrus"
+
+	"juno-contracts-worker/config"
+	"juno-contracts-worker/db"
+	"juno-contracts-worker/db/model"
+)
+
+const (
+	cw20TokensTableName    = "cw20_tokens"
+	cw20TransfersTableName = "cw20_transfers"
+	cw20BalancesTableName  = "cw20_balances"
+)
+
+type cw20 struct {
+	db     db.ServiceInterface
+	log    *logrus.Logger
+	tokens *contracts
+}
+
+func newCw20(d db.ServiceInterface, l *logrus.Logger, cfg *config.Config) *cw20 {
+	return &cw20{
+		db:     d,
+		log:    l,
+		tokens: newContracts(cfg.Cw20CodeIDs),
+	}
+}
+
+func (c *cw20) Name() string {
+	return "cw20"
+}
+
+func (c *cw20) WithDB(tx db.ServiceInterface) Projector {
+	p := *c
+	p.db = tx
+	p.tokens = c.tokens.begin()
+	return &p
+}
+
+func (c *cw20) MergeContracts() {
+	c.tokens.merge()
+}
+
+func (c *cw20) Init() error {
+	tokenFields := map[string]interface{}{
+		"contract_address": "TEXT UNIQUE",
+		"code_id":          "TEXT",
+		"name":             "TEXT",
+		"symbol":           "TEXT",
+		"decimals":         "INT",
+		"minter":           "TEXT",
+		"height":           "NUMERIC",
+	}
+	transferFields := map[string]interface{}{
+		"contract_address": "TEXT",
+		"action":           "TEXT",
+		"from_address":     "TEXT",
+		"to_address":       "TEXT",
+		"amount":           "NUMERIC",
+		"height":           "NUMERIC",
+		"tx_hash":          "TEXT",
+		"msg_index":        "INT",
+	}
+	balanceFields := map[string]interface{}{
+		"contract_address": "TEXT",
+		"address":          "TEXT",
+		"balance":          "NUMERIC",
+		"height":           "NUMERIC",
+		"tx_hash":          "TEXT",
+		"msg_index":        "INT",
+		"seq":              "BIGSERIAL",
+	}
+
+	for tableName, fields := range map[string]model.Fields{
+		cw20TokensTableName:    tokenFields,
+		cw20TransfersTableName: transferFields,
+		cw20BalancesTableName:  balanceFields,
+	} {
+		if err := c.db.CreateTable(tableName, fields); err != nil {
+			return fmt.Errorf("could not create table %s: %w", tableName, err)
+		}
+	}
+
+	// every movement reads the current balance of its addresses
+	if err := c.db.CreateIndex([]string{"contract_address", "address"}, cw20BalancesTableName+"_address_idx", cw20BalancesTableName); err != nil {
+		return fmt.Errorf("could not create index on table %s: %w", cw20BalancesTableName, err)
+	}
+
+	return c.tokens.load(c.db, cw20TokensTableName)
+}
+
+func (c *cw20) Project(m *Message) error {
+	switch m.Kind {
+	case KindInstantiate:
+		if !isCw20Instantiate(m.Msg) {
+			return nil
+		}
+		return c.instantiate(m)
+
+	case KindExecute:
+		return c.execute(m)
+	}
+
+	return nil
+}
+
+func isCw20Instantiate(msg map[string]interface{}) bool {
+	for _, key := range []string{"name", "symbol", "decimals", "initial_balances"} {
+		if _, ok := msg[key]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *cw20) instantiate(m *Message) error {
+	contract := m.Meta.ContractAddress
+	var minter string
+	if mint, ok := m.Msg["mint"].(map[string]interface{}); ok {
+		minter = stringField(mint, "minter")
+	}
+
+	decimals, _ := m.Msg["decimals"].(float64)
+	fields := []string{"id", "contract_address", "code_id", "name", "symbol", "decimals", "minter", "height"}
+	values := []any{rowID(cw20TokensTableName, m.Meta), contract, m.Meta.CodeID,
+		stringField(m.Msg, "name"), stringField(m.Msg, "symbol"), int(decimals), minter, m.Meta.Height}
+	if err := c.db.Insert(cw20TokensTableName, fields, values); err != nil {
+		return err
+	}
+
+	c.tokens.add(contract)
+
+	balances, _ := m.Msg["initial_balances"].([]interface{})
+	for i, b := range balances {
+		balance, ok := b.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if err := c.transfer(m, contract, i, "initial_balance", "", stringField(balance, "address"), stringField(balance, "amount")); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// execute records the movements of known tokens from the wasm events of the message,
+// so transfers, sends, mints and burns of submessages are included
+func (c *cw20) execute(m *Message) error {
+	var events []model.Event
+	if m.Tx != nil {
+		events = m.Tx.WasmEvents(m.Meta.MsgIndex)
+	}
+	// without events only the message itself is read
+	if len(events) == 0 {
+		if !c.tokens.has(m.Meta) {
+			return nil
+		}
+		return c.executeMsg(m)
+	}
+
+	for i, e := range events {
+		contract := e.Value(model.ContractAddressKey)
+		if !c.isToken(m.Meta, contract) {
+			continue
+		}
+
+		action := e.Value("action")
+		if !cw20Actions[action] {
+			continue
+		}
+		if err := c.transfer(m, contract, i, action, e.Value("from"), e.Value("to"), e.Value("amount")); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isToken reports whether the contract of an event is a known token, the contract of the message can also be one by code ID
+func (c *cw20) isToken(meta *model.MessageMeta, contract string) bool {
+	if contract == meta.ContractAddress {
+		return c.tokens.has(meta)
+	}
+	return c.tokens.hasContract(contract)
+}
+
+// cw20Actions are the actions of cw20 events that move tokens, their events carry from, to and amount
+var cw20Actions = map[string]bool{
+	"transfer":      true,
+	"send":          true,
+	"mint":          true,
+	"burn":          true,
+	"transfer_from": true,
+	"send_from":     true,
+	"burn_from":     true,
+}
+
+func (c *cw20) executeMsg(m *Message) error {
+	action, payload := variant(m.Msg)
+	if payload == nil {
+		return nil
+	}
+
+	contract := m.Meta.ContractAddress
+	sender := m.Meta.Sender
+	amount := stringField(payload, "amount")
+
+	switch action {
+	case "transfer":
+		return c.transfer(m, contract, 0, action, sender, stringField(payload, "recipient"), amount)
+	case "send":
+		return c.transfer(m, contract, 0, action, sender, stringField(payload, "contract"), amount)
+	case "mint":
+		return c.transfer(m, contract, 0, action, "", stringField(payload, "recipient"), amount)
+	case "burn":
+		return c.transfer(m, contract, 0, action, sender, "", amount)
+	case "transfer_from":
+		return c.transfer(m, contract, 0, action, stringField(payload, "owner"), stringField(payload, "recipient"), amount)
+	case "send_from":
+		return c.transfer(m, contract, 0, action, stringField(payload, "owner"), stringField(payload, "contract"), amount)
+	case "burn_from":
+		return c.transfer(m, contract, 0, action, stringField(payload, "owner"), "", amount)
+	default:
+		return nil
+	}
+}
+
+// transfer records the movement and the balances after it, an empty address stands for mint or burn
+func (c *cw20) transfer(m *Message, contract string, pos int, action, from, to, amount string) error {
+	value, ok := new(big.Int).SetString(amount, 10)
+	if !ok {
+		c.log.Debugf("Skip cw20 %s with invalid amount %q tx: %s", action, amount, m.Meta.TxHash)
+		return nil
+	}
+
+	fields := []string{"id", "contract_address", "action", "from_address", "to_address", "amount", "height", "tx_hash", "msg_index"}
+	values := []any{rowID(cw20TransfersTableName, m.Meta, pos), contract, action, from, to,
+		value.String(), m.Meta.Height, m.Meta.TxHash, m.Meta.MsgIndex}
+	if err := c.db.Insert(cw20TransfersTableName, fields, values); err != nil {
+		return err
+	}
+
+	if from == to {
+		return nil
+	}
+
+	if from != "" {
+		if err := c.updateBalance(m.Meta, pos, contract, from, new(big.Int).Neg(value)); err != nil {
+			return err
+		}
+	}
+
+	if to != "" {
+		if err := c.updateBalance(m.Meta, pos, contract, to, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *cw20) updateBalance(meta *model.MessageMeta, pos int, contract, address string, delta *big.Int) error {
+	balance, err := c.balance(contract, address)
+	if err != nil {
+		return fmt.Errorf("could not read balance of %s: %w", address, err)
+	}
+	balance.Add(balance, delta)
+
+	fields := []string{"id", "contract_address", "address", "balance", "height", "tx_hash", "msg_index"}
+	values := []any{rowID(cw20BalancesTableName, meta, pos, address), contract, address,
+		balance.String(), meta.Height, meta.TxHash, meta.MsgIndex}
+	return c.db.Insert(cw20BalancesTableName, fields, values)
+}
+
+func (c *cw20) balance(contract, address string) (*big.Int, error) {
+	var balance string
+	qFields := map[string]any{
+		"contract_address": contract,
+		"address":          address,
+	}
+	// the latest change in chain order, like the sync table, seq orders changes within one message
+	orderBy := []model.Order{
+		{Column: "height", Desc: true},
+		{Column: "tx_hash", Desc: true},
+		{Column: "msg_index", Desc: true},
+		{Column: "seq", Desc: true},
+	}
+	limit := int32(1)
+	qParams := &model.QParameters{
+		Fields:  qFields,
+		OrderBy: orderBy,
+		Limit:   &limit,
+	}
+
+	rows, err := c.db.Select(cw20BalancesTableName, []string{"balance"}, qParams)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	value := new(big.Int)
+	if rows.Next() {
+		if err = rows.Scan(&balance); err != nil {
+			return nil, err
+		}
+		value.SetString(balance, 10)
+	}
+
+	return value, nil
+}
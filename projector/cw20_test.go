@@ -0,0 +1,105 @@
+package projector_test
+
+import (
+	"database/sql/driver"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"juno-contracts-worker/db/dbtest"
+	"juno-contracts-worker/db/model"
+)
+
+type Cw20Suite struct {
+	ProjectorSuite
+}
+
+func (s *Cw20Suite) SetupTest() {
+	s.ProjectorSuite.SetupTest()
+	s.known("cw20_tokens", "token")
+	// every address holds 100 before the message
+	s.fake.On(dbtest.Result{Match: `FROM app."cw20_balances"`, Columns: []string{"balance"}, Rows: [][]driver.Value{{"100"}}})
+}
+
+func (s *Cw20Suite) TestMovements() {
+	tests := []struct {
+		name     string
+		contract string
+		msg      string
+		events   []model.Event
+		balances [][]driver.Value
+	}{
+		{
+			name:     "transfer",
+			contract: "token",
+			msg:      `{"transfer": {"recipient": "bob", "amount": "30"}}`,
+			events:   []model.Event{wasmEvent("token", "action", "transfer", "from", "alice", "to", "bob", "amount", "30")},
+			balances: [][]driver.Value{{"alice", "70"}, {"bob", "130"}},
+		},
+		{
+			name:     "send",
+			contract: "token",
+			msg:      `{"send": {"contract": "pool", "amount": "30", "msg": ""}}`,
+			events: []model.Event{
+				wasmEvent("token", "action", "send", "from", "alice", "to", "pool", "amount", "30"),
+				wasmEvent("pool", "action", "receive"),
+			},
+			balances: [][]driver.Value{{"alice", "70"}, {"pool", "130"}},
+		},
+		{
+			name:     "mint",
+			contract: "token",
+			msg:      `{"mint": {"recipient": "bob", "amount": "30"}}`,
+			events:   []model.Event{wasmEvent("token", "action", "mint", "to", "bob", "amount", "30")},
+			balances: [][]driver.Value{{"bob", "130"}},
+		},
+		{
+			name:     "burn",
+			contract: "token",
+			msg:      `{"burn": {"amount": "30"}}`,
+			events:   []model.Event{wasmEvent("token", "action", "burn", "from", "alice", "amount", "30")},
+			balances: [][]driver.Value{{"alice", "70"}},
+		},
+		{
+			name:     "transfer of a submessage",
+			contract: "dao",
+			msg:      `{"execute": {"proposal_id": 1}}`,
+			events: []model.Event{
+				wasmEvent("dao", "action", "execute"),
+				wasmEvent("token", "action", "transfer", "from", "dao", "to", "bob", "amount", "30"),
+			},
+			balances: [][]driver.Value{{"dao", "70"}, {"bob", "130"}},
+		},
+		{
+			name:     "transfer without events",
+			contract: "token",
+			msg:      `{"transfer": {"recipient": "bob", "amount": "30"}}`,
+			balances: [][]driver.Value{{"alice", "70"}, {"bob", "130"}},
+		},
+		{
+			name:     "transfer of an unknown token",
+			contract: "other",
+			msg:      `{"transfer": {"recipient": "bob", "amount": "30"}}`,
+			events:   []model.Event{wasmEvent("other", "action", "transfer", "from", "alice", "to", "bob", "amount", "30")},
+			balances: [][]driver.Value{},
+		},
+	}
+
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			before := len(s.inserted("cw20_balances"))
+
+			var tx *model.TxResult
+			if tt.events != nil {
+				tx = &model.TxResult{Hash: "T", Events: tt.events}
+			}
+			s.project(executeTable, tt.contract, "alice", tt.msg, tx)
+
+			s.Equal(tt.balances, s.inserted("cw20_balances", "address", "balance")[before:])
+		})
+	}
+}
+
+func TestCw20Suite(t *testing.T) {
+	suite.Run(t, new(Cw20Suite))
+}
@@ -0,0 +1,279 @@
+package projector
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"juno-contracts-worker/config"
+	"juno-contracts-worker/db"
+	"juno-contracts-worker/db/model"
+)
+
+const (
+	nftCollectionsTableName = "nft_collections"
+	nftTokensTableName      = "nft_tokens"
+	nftTransfersTableName   = "nft_transfers"
+)
+
+type cw721 struct {
+	db          db.ServiceInterface
+	log         *logrus.Logger
+	collections *contracts
+}
+
+func newCw721(d db.ServiceInterface, l *logrus.Logger, cfg *config.Config) *cw721 {
+	return &cw721{
+		db:          d,
+		log:         l,
+		collections: newContracts(cfg.Cw721CodeIDs),
+	}
+}
+
+func (c *cw721) Name() string {
+	return "cw721"
+}
+
+func (c *cw721) WithDB(tx db.ServiceInterface) Projector {
+	p := *c
+	p.db = tx
+	p.collections = c.collections.begin()
+	return &p
+}
+
+func (c *cw721) MergeContracts() {
+	c.collections.merge()
+}
+
+func (c *cw721) Init() error {
+	collectionFields := map[string]interface{}{
+		"contract_address": "TEXT UNIQUE",
+		"code_id":          "TEXT",
+		"name":             "TEXT",
+		"symbol":           "TEXT",
+		"minter":           "TEXT",
+		"height":           "NUMERIC",
+	}
+	tokenFields := map[string]interface{}{
+		"contract_address": "TEXT",
+		"token_id":         "TEXT",
+		"owner":            "TEXT",
+		"token_uri":        "TEXT",
+		"extension":        "JSONB",
+		"burned":           "BOOLEAN",
+		"minted_height":    "NUMERIC",
+		"height":           "NUMERIC",
+	}
+	transferFields := map[string]interface{}{
+		"contract_address": "TEXT",
+		"token_id":         "TEXT",
+		"action":           "TEXT",
+		"from_address":     "TEXT",
+		"to_address":       "TEXT",
+		"height":           "NUMERIC",
+		"tx_hash":          "TEXT",
+		"msg_index":        "INT",
+		"seq":              "BIGSERIAL",
+	}
+
+	for tableName, fields := range map[string]model.Fields{
+		nftCollectionsTableName: collectionFields,
+		nftTokensTableName:      tokenFields,
+		nftTransfersTableName:   transferFields,
+	} {
+		if err := c.db.CreateTable(tableName, fields); err != nil {
+			return fmt.Errorf("could not create table %s: %w", tableName, err)
+		}
+	}
+
+	return c.collections.load(c.db, nftCollectionsTableName)
+}
+
+func (c *cw721) Project(m *Message) error {
+	switch m.Kind {
+	case KindInstantiate:
+		if !isCw721Instantiate(m.Msg) {
+			return nil
+		}
+		return c.instantiate(m)
+
+	case KindExecute:
+		if !c.collections.has(m.Meta) {
+			return nil
+		}
+		return c.execute(m)
+	}
+
+	return nil
+}
+
+func isCw721Instantiate(msg map[string]interface{}) bool {
+	for _, key := range []string{"name", "symbol", "minter"} {
+		if _, ok := msg[key].(string); !ok {
+			return false
+		}
+	}
+	_, isCw20 := msg["decimals"]
+	return !isCw20
+}
+
+func (c *cw721) instantiate(m *Message) error {
+	contract := m.Meta.ContractAddress
+	fields := []string{"id", "contract_address", "code_id", "name", "symbol", "minter", "height"}
+	values := []any{rowID(nftCollectionsTableName, m.Meta), contract, m.Meta.CodeID,
+		stringField(m.Msg, "name"), stringField(m.Msg, "symbol"), stringField(m.Msg, "minter"), m.Meta.Height}
+	if err := c.db.Insert(nftCollectionsTableName, fields, values); err != nil {
+		return err
+	}
+
+	c.collections.add(contract)
+	return nil
+}
+
+func (c *cw721) execute(m *Message) error {
+	action, payload := variant(m.Msg)
+	if payload == nil {
+		return nil
+	}
+
+	tokenID := stringField(payload, "token_id")
+	if tokenID == "" {
+		return nil
+	}
+
+	switch action {
+	case "mint":
+		return c.mint(m, tokenID, payload)
+	case "transfer_nft":
+		return c.transfer(m, action, tokenID, stringField(payload, "recipient"))
+	case "send_nft":
+		return c.transfer(m, action, tokenID, stringField(payload, "contract"))
+	case "burn":
+		return c.transfer(m, action, tokenID, "")
+	default:
+		return nil
+	}
+}
+
+func (c *cw721) mint(m *Message, tokenID string, payload map[string]interface{}) error {
+	owner := stringField(payload, "owner")
+	extension, err := jsonValue(payload["extension"])
+	if err != nil {
+		return fmt.Errorf("could not marshal extension of token %s: %w", tokenID, err)
+	}
+
+	token, err := c.token(m.Meta.ContractAddress, tokenID)
+	if err != nil {
+		return fmt.Errorf("could not read token %s: %w", tokenID, err)
+	}
+
+	switch {
+	case !token.exists:
+		fields := []string{"id", "contract_address", "token_id", "owner", "token_uri", "extension", "burned", "minted_height", "height"}
+		values := []any{tokenRowID(m.Meta.ContractAddress, tokenID), m.Meta.ContractAddress, tokenID, owner,
+			stringField(payload, "token_uri"), extension, false, m.Meta.Height, m.Meta.Height}
+		if err = c.db.Insert(nftTokensTableName, fields, values); err != nil {
+			return err
+		}
+
+	case token.burned:
+		// a burned token id can be minted again
+		qFields := map[string]any{
+			"id": tokenRowID(m.Meta.ContractAddress, tokenID),
+		}
+		updateFields := map[string]any{
+			"owner":         owner,
+			"token_uri":     stringField(payload, "token_uri"),
+			"extension":     extension,
+			"burned":        false,
+			"minted_height": m.Meta.Height,
+			"height":        m.Meta.Height,
+		}
+		if err = c.db.Update(nftTokensTableName, model.QParameters{Fields: qFields}, updateFields); err != nil {
+			return err
+		}
+	}
+
+	return c.saveTransfer(m, "mint", tokenID, sql.NullString{Valid: true}, owner)
+}
+
+// transfer moves the token to a new owner, burn leaves the token without owner
+func (c *cw721) transfer(m *Message, action, tokenID, to string) error {
+	token, err := c.token(m.Meta.ContractAddress, tokenID)
+	if err != nil {
+		return fmt.Errorf("could not read owner of token %s: %w", tokenID, err)
+	}
+
+	owner := sql.NullString{String: to, Valid: to != ""}
+
+	// tokens minted before indexing started are added on their first transfer, their previous owner is unknown
+	if !token.exists {
+		fields := []string{"id", "contract_address", "token_id", "owner", "burned", "height"}
+		values := []any{tokenRowID(m.Meta.ContractAddress, tokenID), m.Meta.ContractAddress, tokenID, owner, to == "", m.Meta.Height}
+		if err = c.db.Insert(nftTokensTableName, fields, values); err != nil {
+			return err
+		}
+		return c.saveTransfer(m, action, tokenID, token.owner, to)
+	}
+
+	qFields := map[string]any{
+		"id": tokenRowID(m.Meta.ContractAddress, tokenID),
+	}
+	updateFields := map[string]any{
+		"owner":  owner,
+		"burned": to == "",
+		"height": m.Meta.Height,
+	}
+	if err = c.db.Update(nftTokensTableName, model.QParameters{Fields: qFields}, updateFields); err != nil {
+		return err
+	}
+
+	return c.saveTransfer(m, action, tokenID, token.owner, to)
+}
+
+// saveTransfer records a movement of the token, from is empty for mints and NULL when the previous owner is unknown
+func (c *cw721) saveTransfer(m *Message, action, tokenID string, from sql.NullString, to string) error {
+	fields := []string{"id", "contract_address", "token_id", "action", "from_address", "to_address", "height", "tx_hash", "msg_index"}
+	values := []any{rowID(nftTransfersTableName, m.Meta), m.Meta.ContractAddress, tokenID, action, from, to,
+		m.Meta.Height, m.Meta.TxHash, m.Meta.MsgIndex}
+	return c.db.Insert(nftTransfersTableName, fields, values)
+}
+
+// nftToken is the indexed state of a token
+type nftToken struct {
+	exists bool
+	owner  sql.NullString
+	burned bool
+}
+
+func (c *cw721) token(contract, tokenID string) (nftToken, error) {
+	var token nftToken
+	var burned sql.NullBool
+	qFields := map[string]any{
+		"id": tokenRowID(contract, tokenID),
+	}
+
+	rows, err := c.db.Select(nftTokensTableName, []string{"owner", "burned"}, &model.QParameters{Fields: qFields})
+	if err != nil {
+		return token, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return token, rows.Err()
+	}
+
+	if err = rows.Scan(&token.owner, &burned); err != nil {
+		return token, err
+	}
+	token.exists = true
+	token.burned = burned.Bool
+
+	return token, nil
+}
+
+func tokenRowID(contract, tokenID string) uuid.UUID {
+	return uuid.NewSHA1(uuid.NameSpaceOID, []byte(fmt.Sprintf("%s/%s/%s", nftTokensTableName, contract, tokenID)))
+}
@@ -0,0 +1,80 @@
+package projector_test
+
+import (
+	"database/sql/driver"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"juno-contracts-worker/db/dbtest"
+)
+
+type Cw721Suite struct {
+	ProjectorSuite
+}
+
+func (s *Cw721Suite) TestTokens() {
+	tests := []struct {
+		name string
+		msg  string
+		// owner and burned of the indexed token, nil when it is not indexed
+		token    []driver.Value
+		inserted [][]driver.Value
+		updated  [][]driver.Value
+		transfer [][]driver.Value
+	}{
+		{
+			name:     "mint",
+			msg:      `{"mint": {"token_id": "1", "owner": "alice", "token_uri": "ipfs://1"}}`,
+			inserted: [][]driver.Value{{"alice", false}},
+			transfer: [][]driver.Value{{"mint", "", "alice"}},
+		},
+		{
+			name:     "transfer",
+			msg:      `{"transfer_nft": {"token_id": "1", "recipient": "bob"}}`,
+			token:    []driver.Value{"alice", false},
+			updated:  [][]driver.Value{{"bob", false}},
+			transfer: [][]driver.Value{{"transfer_nft", "alice", "bob"}},
+		},
+		{
+			name:     "burn",
+			msg:      `{"burn": {"token_id": "1"}}`,
+			token:    []driver.Value{"bob", false},
+			updated:  [][]driver.Value{{nil, true}},
+			transfer: [][]driver.Value{{"burn", "bob", ""}},
+		},
+		{
+			name:     "mint after burn",
+			msg:      `{"mint": {"token_id": "1", "owner": "carol"}}`,
+			token:    []driver.Value{nil, true},
+			updated:  [][]driver.Value{{"carol", false}},
+			transfer: [][]driver.Value{{"mint", "", "carol"}},
+		},
+		{
+			name:     "transfer of a token minted before indexing",
+			msg:      `{"transfer_nft": {"token_id": "1", "recipient": "bob"}}`,
+			inserted: [][]driver.Value{{"bob", false}},
+			transfer: [][]driver.Value{{"transfer_nft", nil, "bob"}},
+		},
+	}
+
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			s.SetupTest()
+			s.known("nft_collections", "collection")
+			if tt.token != nil {
+				s.fake.On(dbtest.Result{Match: `FROM app."nft_tokens"`, Columns: []string{"owner", "burned"}, Rows: [][]driver.Value{tt.token}})
+			}
+
+			s.project(executeTable, "collection", "alice", tt.msg, nil)
+
+			s.Equal(tt.inserted, s.inserted("nft_tokens", "owner", "burned"))
+			s.Equal(tt.updated, s.updated("nft_tokens", "owner", "burned"))
+			s.Equal(tt.transfer, s.inserted("nft_transfers", "action", "from_address", "to_address"))
+		})
+	}
+}
+
+func TestCw721Suite(t *testing.T) {
+	suite.Run(t, new(Cw721Suite))
+}
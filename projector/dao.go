@@ -0,0 +1,475 @@
+package projector
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+
+	"juno-contracts-worker/config"
+	"juno-contracts-worker/db"
+	"juno-contracts-worker/db/model"
+)
+
+const (
+	daosTableName            = "daos"
+	daoMembersTableName      = "dao_members"
+	proposalModulesTableName = "dao_proposal_modules"
+	proposalsTableName       = "proposals"
+	votesTableName           = "votes"
+
+	proposalStatusOpen     = "open"
+	proposalStatusExecuted = "executed"
+	proposalStatusClosed   = "closed"
+)
+
+// dao projects dao dao core, proposal-single, proposal-multiple and cw4-group messages
+type dao struct {
+	db      db.ServiceInterface
+	log     *logrus.Logger
+	modules *contracts
+	groups  *contracts
+}
+
+func newDao(d db.ServiceInterface, l *logrus.Logger, cfg *config.Config) *dao {
+	return &dao{
+		db:      d,
+		log:     l,
+		modules: newContracts(cfg.DaoProposalCodeIDs),
+		groups:  newContracts(cfg.Cw4GroupCodeIDs),
+	}
+}
+
+func (d *dao) Name() string {
+	return "dao"
+}
+
+func (d *dao) WithDB(tx db.ServiceInterface) Projector {
+	p := *d
+	p.db = tx
+	p.modules = d.modules.begin()
+	p.groups = d.groups.begin()
+	return &p
+}
+
+func (d *dao) MergeContracts() {
+	d.modules.merge()
+	d.groups.merge()
+}
+
+func (d *dao) Init() error {
+	daoFields := map[string]interface{}{
+		"contract_address": "TEXT UNIQUE",
+		"code_id":          "TEXT",
+		"name":             "TEXT",
+		"description":      "TEXT",
+		"image_url":        "TEXT",
+		"voting_module":    "TEXT",
+		"group_address":    "TEXT",
+		"proposal_modules": "TEXT[]",
+		"height":           "NUMERIC",
+	}
+	memberFields := map[string]interface{}{
+		"dao_address":   "TEXT",
+		"group_address": "TEXT",
+		"address":       "TEXT",
+		"weight":        "NUMERIC",
+		"height":        "NUMERIC",
+		"tx_hash":       "TEXT",
+		"msg_index":     "INT",
+		"seq":           "BIGSERIAL",
+	}
+	moduleFields := map[string]interface{}{
+		"contract_address": "TEXT UNIQUE",
+		"height":           "NUMERIC",
+	}
+	proposalFields := map[string]interface{}{
+		"proposal_module": "TEXT",
+		"dao_address":     "TEXT",
+		"proposal_id":     "BIGINT",
+		"proposer":        "TEXT",
+		"title":           "TEXT",
+		"description":     "TEXT",
+		"msgs":            "JSONB",
+		"choices":         "JSONB",
+		"status":          "TEXT",
+		"status_height":   "NUMERIC",
+		"height":          "NUMERIC",
+		"tx_hash":         "TEXT",
+	}
+	voteFields := map[string]interface{}{
+		"proposal_module": "TEXT",
+		"dao_address":     "TEXT",
+		"proposal_id":     "BIGINT",
+		"voter":           "TEXT",
+		"vote":            "TEXT",
+		"rationale":       "TEXT",
+		"height":          "NUMERIC",
+		"tx_hash":         "TEXT",
+		"msg_index":       "INT",
+	}
+
+	for tableName, fields := range map[string]model.Fields{
+		daosTableName:            daoFields,
+		daoMembersTableName:      memberFields,
+		proposalModulesTableName: moduleFields,
+		proposalsTableName:       proposalFields,
+		votesTableName:           voteFields,
+	} {
+		if err := d.db.CreateTable(tableName, fields); err != nil {
+			return fmt.Errorf("could not create table %s: %w", tableName, err)
+		}
+	}
+
+	// modules recognised by their first proposal have no dao row, those of known daos are linked after
+	if err := d.modules.load(d.db, proposalModulesTableName); err != nil {
+		return err
+	}
+
+	return d.loadDaos()
+}
+
+func (d *dao) loadDaos() error {
+	var contract string
+	var group sql.NullString
+	var modules pq.StringArray
+	fields := []string{"contract_address", "group_address", "proposal_modules"}
+
+	rows, err := d.db.Select(daosTableName, fields, &model.QParameters{})
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err = rows.Scan(&contract, &group, &modules); err != nil {
+			return err
+		}
+		for _, module := range modules {
+			d.modules.link(module, contract)
+		}
+		if group.String != "" {
+			d.groups.link(group.String, contract)
+		}
+	}
+
+	return nil
+}
+
+func (d *dao) Project(m *Message) error {
+	switch m.Kind {
+	case KindInstantiate:
+		if isDaoCoreInstantiate(m.Msg) {
+			return d.instantiateDao(m)
+		}
+		if isCw4GroupInstantiate(m.Msg) {
+			return d.instantiateGroup(m)
+		}
+
+	case KindExecute:
+		action, payload := variant(m.Msg)
+		if payload == nil {
+			return nil
+		}
+
+		// proposal modules of daos created before indexing started are recognised by their first proposal
+		if proposal := proposalOf(action, payload); proposal != nil {
+			return d.propose(m, proposal)
+		}
+
+		if d.modules.has(m.Meta) {
+			return d.executeProposalModule(m, action, payload)
+		}
+
+		if d.groups.has(m.Meta) && action == "update_members" {
+			return d.updateMembers(m, payload)
+		}
+	}
+
+	return nil
+}
+
+func isDaoCoreInstantiate(msg map[string]interface{}) bool {
+	_, voting := msg["voting_module_instantiate_info"]
+	_, proposals := msg["proposal_modules_instantiate_info"]
+	return voting && proposals
+}
+
+func isCw4GroupInstantiate(msg map[string]interface{}) bool {
+	members, ok := msg["members"].([]interface{})
+	if !ok || len(msg) > 2 {
+		return false
+	}
+	for _, member := range members {
+		fields, ok := member.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if _, ok = fields["addr"]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// proposalOf returns the proposal of a propose message sent to a proposal module,
+// or to its pre-propose module as {"propose": {"msg": {"propose": {...}}}}
+func proposalOf(action string, payload map[string]interface{}) map[string]interface{} {
+	if action != "propose" {
+		return nil
+	}
+	if isProposal(payload) {
+		return payload
+	}
+
+	msg, _ := payload["msg"].(map[string]interface{})
+	if inner, ok := msg["propose"].(map[string]interface{}); ok && isProposal(inner) {
+		return inner
+	}
+	return nil
+}
+
+func isProposal(payload map[string]interface{}) bool {
+	_, title := payload["title"].(string)
+	_, description := payload["description"].(string)
+	return title && description
+}
+
+func (d *dao) instantiateDao(m *Message) error {
+	core := m.Meta.ContractAddress
+	msgIndex := m.Meta.MsgIndex
+	modules := m.Tx.Attributes(msgIndex, "wasm", "prop_module")
+	voting := m.Tx.Attribute(msgIndex, "wasm", "voting_module")
+	group := m.Tx.Attribute(msgIndex, "wasm", "group_contract_address")
+
+	fields := []string{"id", "contract_address", "code_id", "name", "description", "image_url",
+		"voting_module", "group_address", "proposal_modules", "height"}
+	values := []any{rowID(daosTableName, m.Meta), core, m.Meta.CodeID, stringField(m.Msg, "name"),
+		stringField(m.Msg, "description"), stringField(m.Msg, "image_url"), voting, group, pq.Array(modules), m.Meta.Height}
+	if err := d.db.Insert(daosTableName, fields, values); err != nil {
+		return err
+	}
+
+	for _, module := range modules {
+		d.modules.link(module, core)
+	}
+	if group != "" {
+		d.groups.link(group, core)
+	}
+
+	for i, member := range initialMembers(m.Msg) {
+		if err := d.saveMember(m, i, core, group, member); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// initialMembers reads members of a dao-voting-cw4 module from the base64 instantiate message
+func initialMembers(msg map[string]interface{}) []interface{} {
+	info, _ := msg["voting_module_instantiate_info"].(map[string]interface{})
+	bytes, err := base64.StdEncoding.DecodeString(stringField(info, "msg"))
+	if err != nil {
+		return nil
+	}
+
+	var votingMsg map[string]interface{}
+	if err = json.Unmarshal(bytes, &votingMsg); err != nil {
+		return nil
+	}
+
+	if members, ok := votingMsg["initial_members"].([]interface{}); ok {
+		return members
+	}
+
+	groupContract, _ := votingMsg["group_contract"].(map[string]interface{})
+	newGroup, _ := groupContract["new"].(map[string]interface{})
+	members, _ := newGroup["initial_members"].([]interface{})
+	return members
+}
+
+func (d *dao) instantiateGroup(m *Message) error {
+	group := m.Meta.ContractAddress
+	d.groups.add(group)
+
+	members, _ := m.Msg["members"].([]interface{})
+	for i, member := range members {
+		if err := d.saveMember(m, i, "", group, member); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *dao) updateMembers(m *Message, payload map[string]interface{}) error {
+	group := m.Meta.ContractAddress
+	dao := d.groups.parent(group)
+	pos := 0
+
+	removed, _ := payload["remove"].([]interface{})
+	for _, r := range removed {
+		address, ok := r.(string)
+		if !ok {
+			continue
+		}
+		member := map[string]interface{}{"addr": address, "weight": float64(0)}
+		if err := d.saveMember(m, pos, dao, group, member); err != nil {
+			return err
+		}
+		pos++
+	}
+
+	added, _ := payload["add"].([]interface{})
+	for _, member := range added {
+		if err := d.saveMember(m, pos, dao, group, member); err != nil {
+			return err
+		}
+		pos++
+	}
+
+	return nil
+}
+
+// saveMember appends the weight of a member after the change, removed members have weight 0
+func (d *dao) saveMember(m *Message, pos int, dao, group string, member interface{}) error {
+	fields, ok := member.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	weight, _ := fields["weight"].(float64)
+
+	names := []string{"id", "dao_address", "group_address", "address", "weight", "height", "tx_hash", "msg_index"}
+	values := []any{rowID(daoMembersTableName, m.Meta, pos), dao, group, stringField(fields, "addr"),
+		int64(weight), m.Meta.Height, m.Meta.TxHash, m.Meta.MsgIndex}
+	return d.db.Insert(daoMembersTableName, names, values)
+}
+
+func (d *dao) executeProposalModule(m *Message, action string, payload map[string]interface{}) error {
+	module := m.Meta.ContractAddress
+
+	switch action {
+	case "vote":
+		proposalID, ok := payload["proposal_id"].(float64)
+		if !ok {
+			return nil
+		}
+		if err := d.vote(m, int64(proposalID), payload); err != nil {
+			return err
+		}
+		if status := m.Tx.Attribute(m.Meta.MsgIndex, "wasm", "status"); status != "" {
+			return d.updateStatus(module, int64(proposalID), status, m.Meta.Height)
+		}
+
+	case "execute", "close":
+		proposalID, ok := payload["proposal_id"].(float64)
+		if !ok {
+			return nil
+		}
+		status := proposalStatusExecuted
+		if action == "close" {
+			status = proposalStatusClosed
+		}
+		return d.updateStatus(module, int64(proposalID), status, m.Meta.Height)
+	}
+
+	return nil
+}
+
+// propose saves the proposal created by the message, the module that created it is the contract
+// of the event with its id, a pre-propose module calls it in a submessage
+func (d *dao) propose(m *Message, proposal map[string]interface{}) error {
+	var module, id string
+	if m.Tx != nil {
+		for _, e := range m.Tx.WasmEvents(m.Meta.MsgIndex) {
+			if id = e.Value("proposal_id"); id != "" {
+				module = e.Value(model.ContractAddressKey)
+				break
+			}
+		}
+	}
+
+	proposalID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || module == "" {
+		d.log.Debugf("Skip proposal without proposal_id attribute tx: %s", m.Meta.TxHash)
+		return nil
+	}
+
+	if err = d.learnModule(m.Meta, module); err != nil {
+		return fmt.Errorf("could not save proposal module %s: %w", module, err)
+	}
+
+	msgs, err := jsonValue(proposal["msgs"])
+	if err != nil {
+		return err
+	}
+	choices, err := jsonValue(proposal["choices"])
+	if err != nil {
+		return err
+	}
+
+	fields := []string{"id", "proposal_module", "dao_address", "proposal_id", "proposer", "title", "description",
+		"msgs", "choices", "status", "status_height", "height", "tx_hash"}
+	values := []any{proposalRowID(module, proposalID), module, d.modules.parent(module), proposalID, m.Meta.Sender,
+		stringField(proposal, "title"), stringField(proposal, "description"), msgs, choices,
+		proposalStatusOpen, m.Meta.Height, m.Meta.Height, m.Meta.TxHash}
+	return d.db.Insert(proposalsTableName, fields, values)
+}
+
+// learnModule keeps a proposal module first seen with a proposal, so it is known after a restart
+func (d *dao) learnModule(meta *model.MessageMeta, module string) error {
+	if d.modules.hasContract(module) {
+		return nil
+	}
+
+	id := uuid.NewSHA1(uuid.NameSpaceOID, []byte(fmt.Sprintf("%s/%s", proposalModulesTableName, module)))
+	if err := d.db.Insert(proposalModulesTableName, []string{"id", "contract_address", "height"}, []any{id, module, meta.Height}); err != nil {
+		return err
+	}
+
+	d.modules.add(module)
+	return nil
+}
+
+func (d *dao) vote(m *Message, proposalID int64, payload map[string]interface{}) error {
+	module := m.Meta.ContractAddress
+
+	// proposal-single votes are strings, proposal-multiple votes are objects with option_id
+	vote, ok := payload["vote"].(string)
+	if !ok {
+		value, err := jsonValue(payload["vote"])
+		if err != nil {
+			return err
+		}
+		vote, _ = value.(string)
+	}
+
+	fields := []string{"id", "proposal_module", "dao_address", "proposal_id", "voter", "vote", "rationale",
+		"height", "tx_hash", "msg_index"}
+	values := []any{rowID(votesTableName, m.Meta), module, d.modules.parent(module), proposalID, m.Meta.Sender,
+		vote, stringField(payload, "rationale"), m.Meta.Height, m.Meta.TxHash, m.Meta.MsgIndex}
+	return d.db.Insert(votesTableName, fields, values)
+}
+
+// updateStatus sets the status reported by a vote, an execution or a close. Proposals that expire
+// without any of them stay open, the expiration is only known to the proposal module.
+func (d *dao) updateStatus(module string, proposalID int64, status string, height int32) error {
+	qFields := map[string]any{
+		"id": proposalRowID(module, proposalID),
+	}
+	updateFields := map[string]any{
+		"status":        status,
+		"status_height": height,
+	}
+	return d.db.Update(proposalsTableName, model.QParameters{Fields: qFields}, updateFields)
+}
+
+func proposalRowID(module string, proposalID int64) uuid.UUID {
+	return uuid.NewSHA1(uuid.NameSpaceOID, []byte(fmt.Sprintf("%s/%s/%d", proposalsTableName, module, proposalID)))
+}
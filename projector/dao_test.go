@@ -0,0 +1,95 @@
+package projector_test
+
+import (
+	"database/sql/driver"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"juno-contracts-worker/db/model"
+)
+
+type DaoSuite struct {
+	ProjectorSuite
+}
+
+func (s *DaoSuite) TestProposals() {
+	tests := []struct {
+		name     string
+		contract string
+		msg      string
+		events   []model.Event
+		// module is known from an earlier proposal
+		known     bool
+		modules   [][]driver.Value
+		proposals [][]driver.Value
+		votes     [][]driver.Value
+		statuses  [][]driver.Value
+	}{
+		{
+			name:      "propose",
+			contract:  "module",
+			msg:       `{"propose": {"title": "t", "description": "d", "msgs": []}}`,
+			events:    []model.Event{wasmEvent("module", "action", "propose", "proposal_id", "1", "status", "open")},
+			modules:   [][]driver.Value{{"module"}},
+			proposals: [][]driver.Value{{"module", int64(1), "t", "open"}},
+		},
+		{
+			name:      "propose through a pre-propose module",
+			contract:  "prepropose",
+			msg:       `{"propose": {"msg": {"propose": {"title": "t", "description": "d", "msgs": []}}}}`,
+			events:    []model.Event{wasmEvent("prepropose", "action", "execute_propose"), wasmEvent("module", "action", "propose", "proposal_id", "2")},
+			known:     true,
+			proposals: [][]driver.Value{{"module", int64(2), "t", "open"}},
+		},
+		{
+			name:     "vote",
+			contract: "module",
+			msg:      `{"vote": {"proposal_id": 1, "vote": "yes"}}`,
+			events:   []model.Event{wasmEvent("module", "action", "vote", "proposal_id", "1", "status", "passed")},
+			known:    true,
+			votes:    [][]driver.Value{{"alice", "yes"}},
+			statuses: [][]driver.Value{{"passed"}},
+		},
+		{
+			name:     "execute",
+			contract: "module",
+			msg:      `{"execute": {"proposal_id": 1}}`,
+			known:    true,
+			statuses: [][]driver.Value{{"executed"}},
+		},
+		{
+			name:     "close",
+			contract: "module",
+			msg:      `{"close": {"proposal_id": 1}}`,
+			known:    true,
+			statuses: [][]driver.Value{{"closed"}},
+		},
+		{
+			name:     "vote of an unknown module",
+			contract: "other",
+			msg:      `{"vote": {"proposal_id": 1, "vote": "yes"}}`,
+			known:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			s.SetupTest()
+			if tt.known {
+				s.known("dao_proposal_modules", "module")
+			}
+
+			s.project(executeTable, tt.contract, "alice", tt.msg, &model.TxResult{Hash: "T", Events: tt.events})
+
+			s.Equal(tt.modules, s.inserted("dao_proposal_modules", "contract_address"))
+			s.Equal(tt.proposals, s.inserted("proposals", "proposal_module", "proposal_id", "title", "status"))
+			s.Equal(tt.votes, s.inserted("votes", "voter", "vote"))
+			s.Equal(tt.statuses, s.updated("proposals", "status"))
+		})
+	}
+}
+
+func TestDaoSuite(t *testing.T) {
+	suite.Run(t, new(DaoSuite))
+}
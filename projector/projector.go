@@ -0,0 +1,294 @@
+package projector
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"juno-contracts-worker/config"
+	"juno-contracts-worker/db"
+	"juno-contracts-worker/db/model"
+)
+
+const (
+	KindInstantiate = "instantiate"
+	KindExecute     = "execute"
+)
+
+// Projector keeps curated tables for a known contract family next to the generic entity tables
+type Projector interface {
+	Name() string
+	Init() error
+	Project(m *Message) error
+	// WithDB returns the projector writing to d, like a transaction,
+	// contracts it sees are kept apart until MergeContracts
+	WithDB(d db.ServiceInterface) Projector
+	MergeContracts()
+}
+
+type Message struct {
+	Kind string
+	Meta *model.MessageMeta
+	Msg  map[string]interface{}
+	Tx   *model.TxResult
+}
+
+type Service struct {
+	db         db.ServiceInterface
+	log        *logrus.Logger
+	projectors []Projector
+}
+
+func New(d db.ServiceInterface, l *logrus.Logger, cfg *config.Config) *Service {
+	return &Service{
+		db:  d,
+		log: l,
+		projectors: []Projector{
+			newCw20(d, l, cfg),
+			newCw721(d, l, cfg),
+			newDao(d, l, cfg),
+		},
+	}
+}
+
+// WithDB returns a copy of the service whose projectors write to d
+func (s *Service) WithDB(d db.ServiceInterface) *Service {
+	projectors := make([]Projector, len(s.projectors))
+	for i, p := range s.projectors {
+		projectors[i] = p.WithDB(d)
+	}
+	return &Service{
+		db:         d,
+		log:        s.log,
+		projectors: projectors,
+	}
+}
+
+// MergeContracts makes the contracts seen in the transaction known to all goroutines,
+// it is called once the transaction committed
+func (s *Service) MergeContracts() {
+	for _, p := range s.projectors {
+		p.MergeContracts()
+	}
+}
+
+func (s *Service) Init() error {
+	for _, p := range s.projectors {
+		if err := p.Init(); err != nil {
+			return fmt.Errorf("could not init %s projector: %w", p.Name(), err)
+		}
+	}
+	return nil
+}
+
+func (s *Service) Project(tableName, msg string, meta *model.MessageMeta, tx *model.TxResult) error {
+	if !meta.TxSuccess {
+		return nil
+	}
+
+	var jsonMap map[string]interface{}
+	if err := json.Unmarshal([]byte(msg), &jsonMap); err != nil {
+		return fmt.Errorf("could not unmarshal msg: %w", err)
+	}
+
+	inner, ok := jsonMap["msg"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	m := &Message{
+		Kind: MessageKind(tableName),
+		Meta: meta,
+		Msg:  inner,
+		Tx:   tx,
+	}
+	if m.Kind == "" {
+		return nil
+	}
+
+	for _, p := range s.projectors {
+		if err := p.Project(m); err != nil {
+			return fmt.Errorf("%s projector: %w", p.Name(), err)
+		}
+	}
+
+	return nil
+}
+
+// contracts tracks addresses that belong to a projector, either seen at instantiation or by configured code ID,
+// every address can be linked with a parent contract like the dao of a proposal module.
+// Contracts of a transaction are pending until they are merged after its commit.
+type contracts struct {
+	codeIDs map[string]bool
+	*knownContracts
+	pending map[string]string
+}
+
+type knownContracts struct {
+	mu    sync.Mutex
+	known map[string]string
+}
+
+func newContracts(codeIDs []string) *contracts {
+	c := &contracts{
+		codeIDs:        make(map[string]bool),
+		knownContracts: &knownContracts{known: make(map[string]string)},
+	}
+	for _, codeID := range codeIDs {
+		c.codeIDs[codeID] = true
+	}
+	return c
+}
+
+// begin returns the contracts of a transaction
+func (c *contracts) begin() *contracts {
+	return &contracts{
+		codeIDs:        c.codeIDs,
+		knownContracts: c.knownContracts,
+		pending:        make(map[string]string),
+	}
+}
+
+// merge adds the pending contracts to the known ones
+func (c *contracts) merge() {
+	if c.pending == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for contract, parent := range c.pending {
+		if parent == "" && c.known[contract] != "" {
+			continue
+		}
+		c.known[contract] = parent
+	}
+	c.pending = make(map[string]string)
+}
+
+func (c *contracts) load(d db.ServiceInterface, tableName string) error {
+	var contract string
+	rows, err := d.Select(tableName, []string{"contract_address"}, &model.QParameters{})
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for rows.Next() {
+		if err = rows.Scan(&contract); err != nil {
+			return err
+		}
+		c.known[contract] = ""
+	}
+
+	return nil
+}
+
+func (c *contracts) add(contract string) {
+	c.link(contract, "")
+}
+
+func (c *contracts) link(contract, parent string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pending != nil {
+		c.set(c.pending, contract, parent)
+		return
+	}
+	c.set(c.known, contract, parent)
+}
+
+// set keeps the parent of a linked contract when it is added again, the lock is held by the caller
+func (c *contracts) set(m map[string]string, contract, parent string) {
+	if current, _ := c.lookup(contract); parent == "" && current != "" {
+		return
+	}
+	m[contract] = parent
+}
+
+// lookup returns the parent of a known or pending contract, the lock is held by the caller
+func (c *contracts) lookup(contract string) (string, bool) {
+	if parent, ok := c.pending[contract]; ok {
+		return parent, true
+	}
+	parent, ok := c.known[contract]
+	return parent, ok
+}
+
+func (c *contracts) parent(contract string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	parent, _ := c.lookup(contract)
+	return parent
+}
+
+func (c *contracts) has(meta *model.MessageMeta) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, known := c.lookup(meta.ContractAddress)
+	return known || c.codeIDs[meta.CodeID]
+}
+
+// hasContract reports whether the contract was seen, contracts of configured code IDs are only known from their messages
+func (c *contracts) hasContract(contract string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, known := c.lookup(contract)
+	return known
+}
+
+// MessageKind is KindInstantiate or KindExecute for the message tables of those messages
+func MessageKind(tableName string) string {
+	switch {
+	case strings.Contains(tableName, KindInstantiate):
+		return KindInstantiate
+	case strings.Contains(tableName, KindExecute):
+		return KindExecute
+	default:
+		return ""
+	}
+}
+
+// rowID derives the id from the message position so reprocessing a message does not duplicate rows
+func rowID(table string, meta *model.MessageMeta, parts ...any) uuid.UUID {
+	name := fmt.Sprintf("%s/%s/%d", table, meta.TxHash, meta.MsgIndex)
+	for _, p := range parts {
+		name += fmt.Sprintf("/%v", p)
+	}
+	return uuid.NewSHA1(uuid.NameSpaceOID, []byte(name))
+}
+
+// variant returns the single key of an execute message and its payload
+func variant(msg map[string]interface{}) (string, map[string]interface{}) {
+	if len(msg) != 1 {
+		return "", nil
+	}
+	for k, v := range msg {
+		payload, _ := v.(map[string]interface{})
+		return k, payload
+	}
+	return "", nil
+}
+
+func stringField(m map[string]interface{}, key string) string {
+	s, _ := m[key].(string)
+	return s
+}
+
+// jsonValue marshals v for JSONB columns, missing values stay NULL
+func jsonValue(v interface{}) (any, error) {
+	if v == nil {
+		return nil, nil
+	}
+	bytes, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return string(bytes), nil
+}
@@ -0,0 +1,84 @@
+package projector_test
+
+import (
+	"database/sql/driver"
+	"os"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/suite"
+
+	"juno-contracts-worker/config"
+	"juno-contracts-worker/db"
+	"juno-contracts-worker/db/dbtest"
+	"juno-contracts-worker/db/model"
+	"juno-contracts-worker/projector"
+)
+
+const (
+	instantiateTable = "msg_instantiate_contracts"
+	executeTable     = "msg_execute_contracts"
+)
+
+// ProjectorSuite runs the projectors on a fake database
+type ProjectorSuite struct {
+	suite.Suite
+	fake      *dbtest.DB
+	projector *projector.Service
+}
+
+func (s *ProjectorSuite) SetupTest() {
+	conn, fake, err := dbtest.Open()
+	s.Require().NoError(err)
+	s.fake = fake
+
+	log := logrus.New()
+	log.SetOutput(os.Stderr)
+	s.projector = projector.New(db.NewWithConn(log, conn), log, &config.Config{})
+}
+
+// known makes the contracts of table known as if they were instantiated before
+func (s *ProjectorSuite) known(table string, contracts ...string) {
+	var rows [][]driver.Value
+	for _, c := range contracts {
+		rows = append(rows, []driver.Value{c})
+	}
+	s.fake.On(dbtest.Result{Match: `SELECT "contract_address" FROM app."` + table + `"`, Columns: []string{"contract_address"}, Rows: rows})
+	s.Require().NoError(s.projector.Init())
+}
+
+// project projects msg sent to contract by sender, events are left out when tx is nil
+func (s *ProjectorSuite) project(table, contract, sender, msg string, tx *model.TxResult) {
+	meta := &model.MessageMeta{TxSuccess: true, Height: 10, TxHash: "T", Sender: sender, ContractAddress: contract}
+	s.Require().NoError(s.projector.Project(table, `{"msg": `+msg+`}`, meta, tx))
+}
+
+// inserted returns the values of columns in the rows inserted into table
+func (s *ProjectorSuite) inserted(table string, columns ...string) [][]driver.Value {
+	return s.values(`INSERT INTO app."`+table+`"`, columns...)
+}
+
+// updated returns the values of columns set by the updates of table
+func (s *ProjectorSuite) updated(table string, columns ...string) [][]driver.Value {
+	return s.values(`UPDATE app."`+table+`"`, columns...)
+}
+
+func (s *ProjectorSuite) values(match string, columns ...string) [][]driver.Value {
+	var rows [][]driver.Value
+	for _, c := range s.fake.Find(match) {
+		row := make([]driver.Value, len(columns))
+		for i, column := range columns {
+			row[i], _ = c.Arg(column)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// wasmEvent is a wasm event of contract with attributes given as key value pairs
+func wasmEvent(contract string, pairs ...string) model.Event {
+	e := model.Event{Type: "wasm", Attributes: []model.Attribute{{Key: model.ContractAddressKey, Value: contract}}}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		e.Attributes = append(e.Attributes, model.Attribute{Key: pairs[i], Value: pairs[i+1]})
+	}
+	return e
+}
@@ -1,18 +1,21 @@
 package utils
 
 import (
+	"crypto/sha1"
+	"encoding/json"
 	"fmt"
-	"os"
-	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
 
+	"github.com/cosmos/cosmos-sdk/types/bech32"
+	"github.com/iancoleman/strcase"
 	"github.com/sirupsen/logrus"
 )
 
 func DeleteS(str string) string {
 	lastCh := len(str) - 1
-	if string(str[lastCh]) == "s" {
+	if lastCh >= 0 && string(str[lastCh]) == "s" {
 		str = str[0:lastCh]
 	}
 	return str
@@ -56,46 +59,172 @@ func UniqueShortNames(names []string) (shortNames []string) {
 	return shortNames
 }
 
-func UniqueShortName(name string) (shortName string) {
+const (
+	// MaxIdentifierLength is the postgres limit, longer identifiers are truncated silently
+	MaxIdentifierLength = 63
+	nameHashLength      = 10
+)
+
+var shortNameRegex = regexp.MustCompile(`_h[0-9a-f]{10}$`)
+
+// UniqueShortName abbreviates generated names to a readable prefix and a hash of the full name,
+// names owned by the worker are kept unless they are too long. Short names are returned as they are.
+func UniqueShortName(name string) string {
+	if shortNameRegex.MatchString(name) && len(name) <= MaxIdentifierLength {
+		return name
+	}
+
+	arr := strings.Split(name, "_")
+	// only generated names carry a code ID, tables owned by the worker keep their names
+	if !hasNumericSegment(arr) {
+		if len(name) <= MaxIdentifierLength {
+			return name
+		}
+		return withHash(name, name)
+	}
+
+	prefix := ""
+	for _, s := range arr {
+		if s == "" {
+			continue
+		}
+		if _, err := strconv.Atoi(s); err == nil {
+			prefix += s
+		} else {
+			prefix += string(s[0])
+		}
+	}
+
+	return withHash(prefix, name)
+}
+
+// LegacyShortName is the name versions before the hash gave to a generated name, postgres truncated
+// it silently when it was too long. It is only used to rename tables and columns of such versions.
+func LegacyShortName(name string) string {
 	arr := strings.Split(name, "_")
+	if !hasNumericSegment(arr) {
+		return name
+	}
+
+	shortName := ""
 	l := len(arr)
 	for i, s := range arr {
 		_, err := strconv.Atoi(s)
 		if err == nil || i > l-3 {
 			shortName += s
-		} else {
+		} else if s != "" {
 			shortName += string(s[0])
 		}
 	}
 
+	if len(shortName) > MaxIdentifierLength {
+		shortName = shortName[:MaxIdentifierLength]
+	}
 	return shortName
 }
 
-func IsArray(val []interface{}) (bool, string) {
-	if len(val) == 0 {
-		return true, "String"
+func withHash(prefix, name string) string {
+	hash := fmt.Sprintf("%x", sha1.Sum([]byte(name)))[:nameHashLength]
+	if limit := MaxIdentifierLength - len(hash) - 2; len(prefix) > limit {
+		prefix = prefix[:limit]
 	}
+	return fmt.Sprintf("%s_h%s", prefix, hash)
+}
 
-	kind := reflect.TypeOf(val[0]).Kind()
+var invalidIdentifierRegex = regexp.MustCompile(`[^a-z0-9_]`)
 
-	switch kind {
-	case reflect.String:
-		return true, "String"
-	case reflect.Map:
-		return isMapArray(val[0].(map[string]interface{}))
-	default:
-		fmt.Println("uknown kind: ", kind)
-		os.Exit(666)
+// Identifier normalizes a name to lower case letters, digits and underscores within the postgres limit.
+// It is the one place names are made safe, valid names are returned as they are.
+func Identifier(name string) string {
+	id := invalidIdentifierRegex.ReplaceAllString(strings.ToLower(name), "_")
+	if id == "" {
+		id = "_"
+	}
+	if len(id) > MaxIdentifierLength {
+		id = withHash(id, name)
 	}
+	return id
+}
+
+// IsIdentifier reports whether name is used in SQL as it is, without being changed by Identifier
+func IsIdentifier(name string) bool {
+	return name != "" && Identifier(name) == name
+}
 
-	return false, ""
+// ColumnName maps a json key to its column
+func ColumnName(key string) string {
+	return Identifier(strcase.ToSnake(key))
 }
 
-func isMapArray(m map[string]interface{}) (bool, string) {
-	if k, ok := m["0"]; ok && k != nil && len(m) > 0 {
-		return true, reflect.TypeOf(k).String()
+// QuoteIdentifier normalizes a name and quotes it, so keys like type, order or from are plain columns
+func QuoteIdentifier(name string) string {
+	return fmt.Sprintf(`"%s"`, Identifier(name))
+}
+
+func QuoteIdentifiers(names []string) []string {
+	quoted := make([]string, len(names))
+	for idx, name := range names {
+		quoted[idx] = QuoteIdentifier(name)
+	}
+	return quoted
+}
+
+func hasNumericSegment(arr []string) bool {
+	for _, s := range arr {
+		if _, err := strconv.Atoi(s); err == nil {
+			return true
+		}
 	}
-	return false, ""
+	return false
+}
+
+const (
+	ArrayEmpty   = ""
+	ArrayText    = "TEXT[]"
+	ArrayNumeric = "NUMERIC[]"
+	ArrayBoolean = "BOOLEAN[]"
+	ArrayJson    = "JSONB"
+	ArrayObjects = "OBJECTS"
+)
+
+// ArrayType returns the column type of a json array, arrays of objects are saved as related entities,
+// nested and mixed arrays as JSONB and the type of empty arrays is left for later messages
+func ArrayType(val []interface{}) string {
+	arrayType := ArrayEmpty
+
+	for _, v := range val {
+		if v == nil {
+			continue
+		}
+
+		t := ArrayJson
+		switch v.(type) {
+		case string:
+			t = ArrayText
+		case json.Number, float64:
+			t = ArrayNumeric
+		case bool:
+			t = ArrayBoolean
+		case map[string]interface{}:
+			t = ArrayObjects
+			if isMapArray(v.(map[string]interface{})) {
+				t = ArrayText
+			}
+		}
+
+		if arrayType != ArrayEmpty && arrayType != t {
+			return ArrayJson
+		}
+		arrayType = t
+	}
+
+	return arrayType
+}
+
+// isMapArray reports arrays encoded by SubQuery as maps with index keys
+func isMapArray(m map[string]interface{}) bool {
+	k, ok := m["0"]
+	return ok && k != nil
 }
 
 func GetFieldName(str string) string {
@@ -112,6 +241,69 @@ func GetFieldName(str string) string {
 	return ""
 }
 
+var numericString = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+
+// NumberType maps integers that fit int64 to BIGINT, bigger integers and fractions to NUMERIC
+func NumberType(n json.Number) string {
+	if _, err := n.Int64(); err == nil {
+		return "BIGINT"
+	}
+	return "NUMERIC"
+}
+
+// IsNumericString reports strings like Uint128 and Decimal values of CosmWasm messages
+func IsNumericString(s string) bool {
+	return numericString.MatchString(s)
+}
+
+// WidenType returns the narrowest column type that holds values of both types,
+// integers widen to NUMERIC and everything else to TEXT
+func WidenType(a, b string) string {
+	switch {
+	case a == b:
+		return a
+	case a == "TEXT" || b == "TEXT":
+		return "TEXT"
+	case isIntegerType(a) && isIntegerType(b):
+		return "BIGINT"
+	case isNumberType(a) && isNumberType(b):
+		return "NUMERIC"
+	case strings.HasSuffix(a, "[]") && strings.HasSuffix(b, "[]"):
+		return "TEXT[]"
+	default:
+		return "TEXT"
+	}
+}
+
+func isIntegerType(t string) bool {
+	return t == "INT" || t == "BIGINT"
+}
+
+func isNumberType(t string) bool {
+	return isIntegerType(t) || t == "NUMERIC"
+}
+
+// SiblingColumn names the column that keeps values of another type than the original column
+func SiblingColumn(column, columnType string) string {
+	suffix := strings.ToLower(strings.TrimSuffix(columnType, "[]"))
+	if strings.HasSuffix(columnType, "[]") {
+		suffix += "_array"
+	}
+	return fmt.Sprintf("%s_%s", column, suffix)
+}
+
+// AddressPrefix returns the human readable part of a valid bech32 address, like juno or junovaloper
+func AddressPrefix(s string) (string, bool) {
+	if len(s) < 39 || len(s) > 90 {
+		return "", false
+	}
+	prefix, _, err := bech32.DecodeAndConvert(s)
+	if err != nil {
+		return "", false
+	}
+	return prefix, true
+}
+
 func LogLevel(s string) logrus.Level {
 	switch s {
 	case "debug":
@@ -1,6 +1,10 @@
 package utils_test
 
 import (
+	"encoding/json"
+	"strings"
+
+	"github.com/cosmos/cosmos-sdk/types/bech32"
 	"github.com/stretchr/testify/suite"
 
 	"juno-contracts-worker/utils"
@@ -14,9 +18,39 @@ type Utils struct {
 
 func (u *Utils) TestShortString() {
 	str := "msg_instantiate_contract_42_group_instantiate_newgroup_voter"
-	expect := "mic42ginv"
+	expect := "mic42ginv_h68d8dfc0d0"
 
 	u.Equal(expect, utils.UniqueShortName(str))
+
+	u.Equal(expect, utils.UniqueShortName(expect))
+}
+
+func (u *Utils) TestShortStringCollisions() {
+	u.NotEqual(utils.UniqueShortName("msg_instantiate_contract_42_group_x"), utils.UniqueShortName("my_item_class_42_gadget_x"))
+}
+
+func (u *Utils) TestShortStringLimit() {
+	long := strings.Repeat("segment_", 10) + "42_" + strings.Repeat("x", 80)
+	short := utils.UniqueShortName(long)
+
+	u.LessOrEqual(len(short), utils.MaxIdentifierLength)
+
+	u.Equal(short, utils.UniqueShortName(short))
+
+	worker := strings.Repeat("worker_table_", 6)
+	u.LessOrEqual(len(utils.UniqueShortName(worker)), utils.MaxIdentifierLength)
+}
+
+func (u *Utils) TestShortStringKeepsWorkerTables() {
+	u.Equal("wasm_event_attributes", utils.UniqueShortName("wasm_event_attributes"))
+
+	u.Equal("wasm_events_code42", utils.UniqueShortName("wasm_events_code42"))
+}
+
+func (u *Utils) TestLegacyShortName() {
+	u.Equal("mic42groupx", utils.LegacyShortName("msg_instantiate_contract_42_group_x"))
+
+	u.Equal("wasm_events", utils.LegacyShortName("wasm_events"))
 }
 
 func (u *Utils) TestAddUnderscore() {
@@ -35,6 +69,92 @@ func (u *Utils) TestGetFieldName() {
 	u.Equal("mic504checkmint", utils.GetFieldName(text))
 }
 
+func (u *Utils) TestNumberType() {
+	u.Equal("BIGINT", utils.NumberType(json.Number("42")))
+
+	u.Equal("NUMERIC", utils.NumberType(json.Number("340282366920938463463374607431768211455")))
+
+	u.Equal("NUMERIC", utils.NumberType(json.Number("0.5")))
+}
+
+func (u *Utils) TestIsNumericString() {
+	u.True(utils.IsNumericString("1000000"))
+
+	u.True(utils.IsNumericString("0.125"))
+
+	u.False(utils.IsNumericString("1e6"))
+
+	u.False(utils.IsNumericString("juno1abc"))
+}
+
+func (u *Utils) TestArrayType() {
+	u.Equal(utils.ArrayEmpty, utils.ArrayType([]interface{}{}))
+
+	u.Equal(utils.ArrayText, utils.ArrayType([]interface{}{"a", nil, "b"}))
+
+	u.Equal(utils.ArrayNumeric, utils.ArrayType([]interface{}{json.Number("1"), json.Number("2.5")}))
+
+	u.Equal(utils.ArrayBoolean, utils.ArrayType([]interface{}{true, false}))
+
+	u.Equal(utils.ArrayText, utils.ArrayType([]interface{}{map[string]interface{}{"0": "a", "1": "b"}}))
+
+	u.Equal(utils.ArrayObjects, utils.ArrayType([]interface{}{map[string]interface{}{"addr": "a"}, map[string]interface{}{"weight": 1}}))
+
+	u.Equal(utils.ArrayJson, utils.ArrayType([]interface{}{[]interface{}{"a"}, []interface{}{"b"}}))
+
+	u.Equal(utils.ArrayJson, utils.ArrayType([]interface{}{"a", json.Number("1")}))
+}
+
+func (u *Utils) TestWidenType() {
+	u.Equal("BIGINT", utils.WidenType("BIGINT", "INT"))
+
+	u.Equal("NUMERIC", utils.WidenType("BIGINT", "NUMERIC"))
+
+	u.Equal("TEXT", utils.WidenType("NUMERIC", "TEXT"))
+
+	u.Equal("TEXT", utils.WidenType("BOOLEAN", "BIGINT"))
+
+	u.Equal("TEXT[]", utils.WidenType("NUMERIC[]", "BOOLEAN[]"))
+}
+
+func (u *Utils) TestSiblingColumn() {
+	u.Equal("amount_text", utils.SiblingColumn("amount", "TEXT"))
+
+	u.Equal("ids_numeric_array", utils.SiblingColumn("ids", "NUMERIC[]"))
+}
+
+func (u *Utils) TestIdentifier() {
+	u.Equal("tx_hash", utils.Identifier("tx_hash"))
+
+	u.Equal("from_address", utils.ColumnName("from-address"))
+
+	u.Equal("token_id", utils.ColumnName("tokenId"))
+
+	u.Equal("a_b", utils.ColumnName("a.b"))
+
+	u.Equal(`"order"`, utils.QuoteIdentifier("order"))
+
+	long := utils.ColumnName(strings.Repeat("key", 30))
+	u.LessOrEqual(len(long), utils.MaxIdentifierLength)
+
+	u.Equal(long, utils.Identifier(long))
+}
+
+func (u *Utils) TestAddressPrefix() {
+	address, err := bech32.ConvertAndEncode("juno", make([]byte, 20))
+	u.Require().NoError(err)
+
+	prefix, ok := utils.AddressPrefix(address)
+	u.True(ok)
+	u.Equal("juno", prefix)
+
+	_, ok = utils.AddressPrefix(address[:len(address)-1] + "q")
+	u.False(ok)
+
+	_, ok = utils.AddressPrefix("transfer")
+	u.False(ok)
+}
+
 func TestUtils(t *testing.T) {
 	suite.Run(t, new(Utils))
 }
@@ -0,0 +1,13 @@
+package worker
+
+import "juno-contracts-worker/db/model"
+
+// SyncMessage exposes syncMessage to the tests of package worker_test
+func (s *Service) SyncMessage(tableName string, unsync *model.Unsync) error {
+	return s.syncMessage(tableName, unsync)
+}
+
+// WaitForInstantiations exposes waitForInstantiations to the tests of package worker_test
+func (s *Service) WaitForInstantiations(tableName string, height int32) error {
+	return s.waitForInstantiations(tableName, height)
+}
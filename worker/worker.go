@@ -1,34 +1,91 @@
 package worker
 
 import (
+	"database/sql"
 	"fmt"
 	"sync"
 	"time"
 
+	"juno-contracts-worker/config"
 	"juno-contracts-worker/db"
 	"juno-contracts-worker/db/model"
 	"juno-contracts-worker/indexer"
+	"juno-contracts-worker/projector"
 
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 )
 
-const syncTableName = "sync"
+const (
+	syncTableName = "sync"
+	syncIndexName = "syncidx"
+)
 
 type Service struct {
-	db      db.ServiceInterface
-	log     *logrus.Logger
-	indexer *indexer.Service
+	db        db.ServiceInterface
+	log       *logrus.Logger
+	indexer   *indexer.Service
+	projector *projector.Service
+	cfg       *config.Config
+	progress  *progress
+}
+
+// waitWarnAttempts is the number of checks after which a wait for instantiations is logged as a warning
+const waitWarnAttempts = 60
+
+// progress keeps when every message table was last fetched into the sync table,
+// and which tables stopped syncing
+type progress struct {
+	mu        sync.Mutex
+	fetchedAt map[string]time.Time
+	stopped   map[string]bool
+}
+
+func (p *progress) fetched(tableName string, at time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.fetchedAt[tableName] = at
+}
+
+// fetchedAfter reports whether the last fetch of tableName started after the last fetch of other
+func (p *progress) fetchedAfter(tableName, other string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	at, ok := p.fetchedAt[tableName]
+	return ok && at.After(p.fetchedAt[other])
 }
 
-func New(db db.ServiceInterface, l *logrus.Logger, i *indexer.Service) (*Service, error) {
+func (p *progress) stop(tableName string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stopped[tableName] = true
+}
+
+func (p *progress) isStopped(tableName string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stopped[tableName]
+}
+
+func New(db db.ServiceInterface, l *logrus.Logger, i *indexer.Service, p *projector.Service, cfg *config.Config) (*Service, error) {
 	s := &Service{
-		db:      db,
-		log:     l,
-		indexer: i,
+		db:        db,
+		log:       l,
+		indexer:   i,
+		projector: p,
+		cfg:       cfg,
+		progress:  &progress{fetchedAt: make(map[string]time.Time), stopped: make(map[string]bool)},
+	}
+
+	if err := s.initSyncHeightTable(); err != nil {
+		return nil, err
 	}
 
-	return s, s.initSyncHeightTable()
+	if err := i.InitTables(); err != nil {
+		return nil, err
+	}
+
+	return s, p.Init()
 }
 
 func (s *Service) initSyncHeightTable() error {
@@ -47,7 +104,8 @@ func (s *Service) initSyncHeightTable() error {
 		return fmt.Errorf("could not create table %s: %w", syncTableName, err)
 	}
 
-	if err := s.db.CreateUniqueIndex(uniqueIndexColums, syncTableName+"_idx", syncTableName); err != nil {
+	// older versions shortened the index name to syncidx, keeping it avoids a duplicate index
+	if err := s.db.CreateUniqueIndex(uniqueIndexColums, syncIndexName, syncTableName); err != nil {
 		return fmt.Errorf("could not create table %s: %w", syncTableName, err)
 	}
 
@@ -56,29 +114,35 @@ func (s *Service) initSyncHeightTable() error {
 
 func (s *Service) fetch(tableName string) error {
 	s.log.Info("Fetching messages to process from table ", tableName)
+	start := time.Now()
 
 	lastSync, err := s.fetchLastSync(tableName)
 	if err != nil {
 		return err
 	}
 
-	return s.fetchMessagesByHeight(tableName, lastSync)
+	if err = s.fetchMessagesByHeight(tableName, lastSync); err != nil {
+		return err
+	}
+
+	s.progress.fetched(tableName, start)
+	return nil
 }
 
 func (s *Service) fetchLastSync(tableName string) (height int32, err error) {
 	fields := []string{"height"}
-	orderBy := map[string]string{
-		"height":  "DESC",
-		"tx_hash": "DESC",
-		"index":   "DESC",
+	orderBy := []model.Order{
+		{Column: "height", Desc: true},
+		{Column: "tx_hash", Desc: true},
+		{Column: "index", Desc: true},
 	}
-	fieldsEqual := map[string]string{
-		"name": fmt.Sprintf("'%s'", tableName),
+	fieldsEqual := map[string]any{
+		"name": tableName,
 	}
 	limit := int32(1)
 	qParams := &model.QParameters{
-		OrderBy: &orderBy,
-		Fields:  &fieldsEqual,
+		OrderBy: orderBy,
+		Fields:  fieldsEqual,
 		Limit:   &limit,
 	}
 	rows, err := s.db.Select(syncTableName, fields, qParams)
@@ -98,19 +162,19 @@ func (s *Service) fetchLastSync(tableName string) (height int32, err error) {
 func (s *Service) fetchFirstUnsync(tableName string) (*model.Unsync, error) {
 	var u model.Unsync
 	fields := []string{"id", "height", "hash", "tx_hash", "index"}
-	orderBy := map[string]string{
-		"height":  "ASC",
-		"tx_hash": "ASC",
-		"index":   "ASC",
+	orderBy := []model.Order{
+		{Column: "height"},
+		{Column: "tx_hash"},
+		{Column: "index"},
 	}
-	fieldsEqual := map[string]string{
-		"name": fmt.Sprintf("'%s'", tableName),
-		"sync": "false",
+	fieldsEqual := map[string]any{
+		"name": tableName,
+		"sync": false,
 	}
 	limit := int32(1)
 	qParams := &model.QParameters{
-		OrderBy: &orderBy,
-		Fields:  &fieldsEqual,
+		OrderBy: orderBy,
+		Fields:  fieldsEqual,
 		Limit:   &limit,
 	}
 	rows, err := s.db.Select(syncTableName, fields, qParams)
@@ -133,13 +197,13 @@ func (s *Service) fetchMessagesByHeight(tableName string, startBlock int32) erro
 	var height, index int32
 	var hash, txHash string
 	qFields := []string{"height", "hash", "tx_hash", "index"}
-	qOrderBy := map[string]string{
-		"height":  "ASC",
-		"tx_hash": "ASC",
-		"index":   "ASC",
+	qOrderBy := []model.Order{
+		{Column: "height"},
+		{Column: "tx_hash"},
+		{Column: "index"},
 	}
 	qParams := &model.QParameters{
-		OrderBy:    &qOrderBy,
+		OrderBy:    qOrderBy,
 		StartBlock: &startBlock,
 	}
 
@@ -173,6 +237,8 @@ func (s *Service) fetchMessagesByHeight(tableName string, startBlock int32) erro
 func (s *Service) StartSync(wg *sync.WaitGroup, tableName string) {
 	s.log.Info("Start processing ", tableName)
 	defer wg.Done()
+	// executes waiting for the instantiations of this table fail instead of waiting forever
+	defer s.progress.stop(tableName)
 
 	if err := s.fetch(tableName); err != nil {
 		s.log.Error("Error while fetching messages from table: ", tableName)
@@ -198,51 +264,246 @@ func (s *Service) StartSync(wg *sync.WaitGroup, tableName string) {
 			continue
 		}
 
-		var id, txHash, msg string
-		var index int32
-		fields := []string{"id", "index", "tx_hash", "msg"}
-
-		qFields := map[string]string{
-			"hash":    fmt.Sprintf("'%s'", firstUnsync.Hash),
-			"height":  fmt.Sprintf("'%d'", firstUnsync.Height),
-			"index":   fmt.Sprintf("'%d'", firstUnsync.Index),
-			"tx_hash": fmt.Sprintf("'%s'", firstUnsync.TxHash),
+		if err = s.waitForInstantiations(tableName, firstUnsync.Height); err != nil {
+			s.log.Errorf("could not check instantiations before height %d of table %s err: %v", firstUnsync.Height, tableName, err)
+			return
 		}
-		qParams := &model.QParameters{Fields: &qFields}
-		rows, err := s.indexer.QueryFields(tableName, fields, qParams)
-		if err != nil {
-			s.log.Errorf("could not query message from table %s tx_hash: %s index: %d err: %w", tableName, txHash, index, err)
+
+		if err = s.syncMessage(tableName, firstUnsync); err != nil {
+			s.log.Errorf("could not process message from table %s tx_hash: %s index: %d err: %v", tableName, firstUnsync.TxHash, firstUnsync.Index, err)
 			return
 		}
+	}
+}
 
-		if rows.Next() {
-			if err = rows.Scan(&id, &index, &txHash, &msg); err != nil {
-				s.log.Errorf("could not read fields from table %s tx_hash: %s index: %d err: %w", tableName, txHash, index, err)
-				return
+// waitForInstantiations holds an execute until every instantiation up to its height is synced.
+// Message tables are synced by separate goroutines, and projections only follow executes
+// of contracts whose instantiation they have seen. The wait fails when the sync of instantiations stops.
+func (s *Service) waitForInstantiations(tableName string, height int32) error {
+	if projector.MessageKind(tableName) != projector.KindExecute {
+		return nil
+	}
+
+	for _, instantiateTable := range s.cfg.Messages {
+		if projector.MessageKind(instantiateTable) != projector.KindInstantiate {
+			continue
+		}
+
+		for attempt := 1; ; attempt++ {
+			synced, err := s.instantiationsSynced(instantiateTable, tableName, height)
+			if err != nil {
+				return err
+			}
+			if synced {
+				break
 			}
 
-			if err = s.indexer.SaveJsonAsEntity(id, tableName[0:len(tableName)-1], msg); err != nil {
-				s.log.Errorf("could not save entity from table %s tx_hash: %s index: %d err: %w", tableName, txHash, index, err)
-				return
+			// a stopped sync is checked after the last query, instantiations synced before it stopped still count
+			if s.progress.isStopped(instantiateTable) {
+				return fmt.Errorf("sync of %s stopped before height %d", instantiateTable, height)
 			}
+
+			if attempt%waitWarnAttempts == 0 {
+				s.log.Warnf("%s waits for %s to sync up to height %d since %d attempts", tableName, instantiateTable, height, attempt)
+			} else {
+				s.log.Debugf("Wait for %s to sync up to height %d", instantiateTable, height)
+			}
+			time.Sleep(time.Second)
 		}
+	}
 
-		if err = s.updateSync(firstUnsync.ID); err != nil {
-			s.log.Errorf("could not update sync with id: %s from table %s tx_hash: %s index: %d err: %w", firstUnsync.ID, tableName, txHash, index, err)
-			return
+	return nil
+}
+
+func (s *Service) instantiationsSynced(instantiateTable, tableName string, height int32) (bool, error) {
+	// instantiations fetched after the execute include those up to its height
+	if !s.progress.fetchedAfter(instantiateTable, tableName) {
+		return false, nil
+	}
+
+	limit := int32(1)
+	qParams := &model.QParameters{
+		Fields: map[string]any{
+			"name": instantiateTable,
+			"sync": false,
+		},
+		EndBlock: &height,
+		Limit:    &limit,
+	}
+	rows, err := s.db.Select(syncTableName, []string{"id"}, qParams)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	return !rows.Next(), rows.Err()
+}
+
+// message is a message row with its tx, read before the transaction of the message begins
+type message struct {
+	id       string
+	msg      string
+	meta     *model.MessageMeta
+	txResult *model.TxResult
+}
+
+// syncMessage saves the message and marks it synced in one transaction,
+// so a failed message leaves neither entity rows nor a synced row behind
+func (s *Service) syncMessage(tableName string, unsync *model.Unsync) error {
+	// node calls do not hold the transaction open
+	m, err := s.readMessage(tableName, unsync)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	txService := *s
+	txService.db = tx
+	txService.indexer = s.indexer.WithDB(tx)
+	txService.projector = s.projector.WithDB(tx)
+
+	if m != nil {
+		err = txService.saveMessage(tableName, m)
+	}
+	if err == nil {
+		if err = txService.updateSync(unsync.ID); err != nil {
+			err = fmt.Errorf("could not update sync with id: %s err: %w", unsync.ID, err)
 		}
 	}
+
+	if err != nil {
+		// cache changes of the transaction are dropped with it
+		if rbErr := tx.Rollback(); rbErr != nil {
+			s.log.Error(rbErr)
+		}
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	txService.indexer.MergeCaches()
+	txService.projector.MergeContracts()
+	return nil
+}
+
+// readMessage reads the message row and fetches its tx and block, it returns nil for messages
+// that are not saved, like those of failed txs
+func (s *Service) readMessage(tableName string, unsync *model.Unsync) (*message, error) {
+	var id, txHash, msg string
+	var index int32
+	var code sql.NullInt64
+	opts := s.cfg.Message(tableName)
+
+	fields := []string{"id", "index", "tx_hash", "msg"}
+	if opts.CodeColumn != "" {
+		fields = append(fields, opts.CodeColumn)
+	}
+
+	qFields := map[string]any{
+		"hash":    unsync.Hash,
+		"height":  unsync.Height,
+		"index":   unsync.Index,
+		"tx_hash": unsync.TxHash,
+	}
+	qParams := &model.QParameters{Fields: qFields}
+	rows, err := s.indexer.QueryFields(tableName, fields, qParams)
+	if err != nil {
+		return nil, fmt.Errorf("could not query message: %w", err)
+	}
+
+	found := rows.Next()
+	if found {
+		dest := []any{&id, &index, &txHash, &msg}
+		if opts.CodeColumn != "" {
+			dest = append(dest, &code)
+		}
+		err = rows.Scan(dest...)
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	// the rows are closed before the next statement, a connection runs one statement at a time
+	rows.Close()
+	if err != nil {
+		return nil, fmt.Errorf("could not read fields: %w", err)
+	}
+	if !found {
+		return nil, nil
+	}
+
+	txResult, err := s.indexer.FetchTxResult(txHash)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch tx result: %w", err)
+	}
+
+	switch {
+	case opts.CodeColumn != "":
+		txResult.Code = uint32(code.Int64)
+	case s.cfg.EventsTable != "":
+		// events come from the table, the rest of the tx from the node
+		tx, err := s.indexer.FetchTx(txHash)
+		if err != nil {
+			return nil, fmt.Errorf("could not fetch tx: %w", err)
+		}
+		tx.Events = txResult.Events
+		txResult = tx
+	}
+
+	blockTime, err := s.indexer.BlockTime(unsync.Height)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch block time: %w", err)
+	}
+
+	meta := &model.MessageMeta{
+		TxSuccess:       txResult.Code == 0,
+		Height:          unsync.Height,
+		TxHash:          txHash,
+		MsgIndex:        index,
+		BlockTime:       blockTime,
+		Fee:             txResult.Fee,
+		Memo:            txResult.Memo,
+		ContractAddress: txResult.Attribute(index, "instantiate", model.ContractAddressKey),
+	}
+	if !meta.TxSuccess && opts.FailedTx == config.FailedTxSkip {
+		s.log.Debugf("Skip message of failed tx %s index: %d", txHash, index)
+		return nil, nil
+	}
+
+	return &message{id: id, msg: msg, meta: meta, txResult: txResult}, nil
+}
+
+// saveMessage writes the entities, events and projections of the message
+func (s *Service) saveMessage(tableName string, m *message) error {
+	if err := s.indexer.SaveJsonAsEntity(m.id, tableName[0:len(tableName)-1], m.msg, m.meta); err != nil {
+		return fmt.Errorf("could not save entity: %w", err)
+	}
+
+	if err := s.indexer.SaveWasmEvents(tableName, m.id, m.meta.Height, m.meta.TxHash, m.meta.MsgIndex, m.txResult); err != nil {
+		return fmt.Errorf("could not save wasm events: %w", err)
+	}
+
+	if err := s.projector.Project(tableName, m.msg, m.meta, m.txResult); err != nil {
+		return fmt.Errorf("could not project message: %w", err)
+	}
+
+	return nil
 }
 
 func (s *Service) updateSync(id string) error {
-	qFields := map[string]string{
-		"id": fmt.Sprintf("'%s'", id),
+	qFields := map[string]any{
+		"id": id,
 	}
 	qParams := model.QParameters{
-		Fields: &qFields,
+		Fields: qFields,
 	}
-	updateFields := map[string]string{
-		"sync": "true",
+	updateFields := map[string]any{
+		"sync": true,
 	}
 	return s.db.Update(syncTableName, qParams, updateFields)
 }
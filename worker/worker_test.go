@@ -0,0 +1,196 @@
+package worker_test
+
+import (
+	"database/sql/driver"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/suite"
+
+	"juno-contracts-worker/config"
+	"juno-contracts-worker/db"
+	"juno-contracts-worker/db/dbtest"
+	"juno-contracts-worker/db/model"
+	"juno-contracts-worker/indexer"
+	"juno-contracts-worker/projector"
+	"juno-contracts-worker/worker"
+)
+
+const (
+	messageTable = "msg_instantiate_contracts"
+	executeTable = "msg_execute_contracts"
+)
+
+type SyncSuite struct {
+	suite.Suite
+	fake   *dbtest.DB
+	worker *worker.Service
+	unsync *model.Unsync
+}
+
+func (s *SyncSuite) SetupTest() {
+	s.setup(config.FailedTxFlag)
+}
+
+// setup starts a worker on a new fake database with the given handling of failed txs
+func (s *SyncSuite) setup(failedTx string) {
+	conn, fake, err := dbtest.Open()
+	s.Require().NoError(err)
+	s.fake = fake
+
+	log := logrus.New()
+	log.SetOutput(os.Stderr)
+	cfg := &config.Config{
+		Messages:    []string{messageTable, executeTable},
+		EventsTable: "tx_events",
+		MessageOptions: map[string]config.MessageOptions{
+			messageTable: {FailedTx: failedTx, CodeColumn: "code"},
+		},
+	}
+
+	d := db.NewWithConn(log, conn)
+	s.worker, err = worker.New(d, log, indexer.New(nil, d, log, cfg), projector.New(d, log, cfg), cfg)
+	s.Require().NoError(err)
+
+	s.block()
+	s.unsync = &model.Unsync{ID: "s1", Height: 100, Hash: "H", TxHash: "T", Index: 0}
+}
+
+func (s *SyncSuite) block() {
+	s.fake.On(dbtest.Result{
+		Match:   `FROM app."blocks"`,
+		Columns: []string{"time"},
+		Rows:    [][]driver.Value{{"2022-07-01T10:00:00Z"}},
+	})
+}
+
+func (s *SyncSuite) message(code int64) {
+	s.fake.On(dbtest.Result{
+		Match:   `FROM app."msg_instantiate_contracts"`,
+		Columns: []string{"id", "index", "tx_hash", "msg", "code"},
+		Rows:    [][]driver.Value{{"m1", int64(0), "T", `{"codeId": "42", "sender": "juno1", "msg": {"name": "token"}}`, code}},
+	})
+}
+
+// sync runs syncMessage and returns the statements it ran
+func (s *SyncSuite) sync() ([]string, error) {
+	before := len(s.fake.Statements())
+	err := s.worker.SyncMessage(messageTable, s.unsync)
+	return s.fake.Statements()[before:], err
+}
+
+func index(statements []string, prefix string) int {
+	for i, statement := range statements {
+		if strings.HasPrefix(statement, prefix) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *SyncSuite) TestMessageIsSavedInTransaction() {
+	s.message(0)
+
+	statements, err := s.sync()
+	s.Require().NoError(err)
+
+	begin, commit := index(statements, dbtest.Begin), index(statements, dbtest.Commit)
+	s.Require().True(begin >= 0 && commit > begin, statements)
+
+	// the message and its block are read before the transaction
+	s.Less(index(statements, `SELECT "id", "index", "tx_hash", "msg", "code" FROM app."msg_instantiate_contracts"`), begin)
+	s.Less(index(statements, `SELECT "time" FROM app."blocks"`), begin)
+
+	for _, statement := range statements[begin+1 : commit] {
+		s.True(strings.HasPrefix(statement, dbtest.InTx), statement)
+	}
+	s.GreaterOrEqual(index(statements, dbtest.InTx+`INSERT INTO app."mic42_h`), 0, statements)
+	s.Equal(commit-1, index(statements, dbtest.InTx+`UPDATE app."sync"`), statements)
+
+	// concurrent index builds run after the commit
+	for _, statement := range statements[:commit] {
+		s.NotContains(statement, "CONCURRENTLY")
+	}
+}
+
+func (s *SyncSuite) TestFailedMessageIsRolledBack() {
+	s.message(0)
+	s.fake.On(dbtest.Result{Match: `UPDATE app."sync"`, Err: errors.New("sync failed")})
+
+	statements, err := s.sync()
+	s.Error(err)
+
+	s.Equal(dbtest.Rollback, statements[len(statements)-1])
+	s.Equal(-1, index(statements, dbtest.Commit))
+}
+
+func (s *SyncSuite) TestRolledBackCachesAreDropped() {
+	s.message(0)
+	s.fake.On(dbtest.Result{Match: `UPDATE app."sync"`, Err: errors.New("sync failed")})
+	_, err := s.sync()
+	s.Require().Error(err)
+
+	s.fake.Clear()
+	s.block()
+	s.message(0)
+	statements, err := s.sync()
+	s.Require().NoError(err)
+
+	// indexes queued by the rolled back transaction are queued again
+	s.GreaterOrEqual(index(statements, `CREATE INDEX CONCURRENTLY IF NOT EXISTS "mic42_h`), 0, statements)
+}
+
+func (s *SyncSuite) TestMissingMessageIsMarkedSynced() {
+	statements, err := s.sync()
+	s.Require().NoError(err)
+
+	begin := index(statements, dbtest.Begin)
+	s.Require().GreaterOrEqual(begin, 0)
+	s.Equal([]string{dbtest.Begin, dbtest.InTx + `UPDATE app."sync" SET "sync"=$1 WHERE "id" = $2;`, dbtest.Commit},
+		statements[begin:])
+}
+
+func (s *SyncSuite) TestFailedTxIsFlagged() {
+	s.message(5)
+
+	_, err := s.sync()
+	s.Require().NoError(err)
+
+	inserts := s.fake.Find(dbtest.InTx + `INSERT INTO app."mic42_h`)
+	s.Require().NotEmpty(inserts)
+	s.Contains(inserts[0].Statement, `"tx_success"`)
+	s.Contains(inserts[0].Args, false)
+}
+
+func (s *SyncSuite) TestFailedTxIsSkipped() {
+	s.setup(config.FailedTxSkip)
+	s.message(5)
+
+	statements, err := s.sync()
+	s.Require().NoError(err)
+
+	// the message is marked synced without being saved
+	begin := index(statements, dbtest.Begin)
+	s.Require().GreaterOrEqual(begin, 0)
+	s.Equal([]string{dbtest.Begin, dbtest.InTx + `UPDATE app."sync" SET "sync"=$1 WHERE "id" = $2;`, dbtest.Commit},
+		statements[begin:])
+}
+
+func (s *SyncSuite) TestWaitFailsWhenInstantiationsStop() {
+	s.fake.On(dbtest.Result{Match: `FROM app."msg_instantiate_contracts"`, Err: errors.New("connection lost")})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	s.worker.StartSync(&wg, messageTable)
+	wg.Wait()
+
+	s.Error(s.worker.WaitForInstantiations(executeTable, 100))
+}
+
+func TestSyncSuite(t *testing.T) {
+	suite.Run(t, new(SyncSuite))
+}